@@ -0,0 +1,321 @@
+package flr
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+// 管理接口中保留的最近通知数量
+const recentNotifications = 100
+
+// activeGroup 最近一次检查中仍在报警的分组
+type activeGroup struct {
+	consumer.Group
+	FirstSeen time.Time `json:"first_seen"`
+	Cycles    int       `json:"cycles"`
+	Tier      int       `json:"tier"`    // 已经升级的 tier 数量
+	Alerted   bool      `json:"alerted"` // 是否已经发送过报警
+}
+
+// activeGroups 每轮检查后更新, 会被管理接口并发访问
+type activeGroups struct {
+	mu      sync.Mutex
+	updated time.Time
+	list    []*activeGroup
+}
+
+func (a *activeGroups) set(list []*activeGroup) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.updated = time.Now()
+	a.list = list
+}
+
+func (a *activeGroups) get() (time.Time, []*activeGroup) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.updated, a.list
+}
+
+// setActive groups 为本轮仍在报警的分组, 需要在 escalations 更新之后调用
+func (p *Processor) setActive(groups []*consumer.Group) {
+	list := make([]*activeGroup, 0, len(groups))
+	for _, group := range groups {
+		item := &activeGroup{Group: *group}
+		if e, ok := p.escalations[group.Tag]; ok {
+			item.FirstSeen = e.Since
+			item.Cycles = e.Cycles
+			item.Tier = e.Tier
+		}
+		_, item.Alerted = p.firing[group.Tag]
+		list = append(list, item)
+	}
+	p.active.set(list)
+}
+
+// notification 一条通知及每个 target 的发送结果
+type notification struct {
+	Time    time.Time       `json:"time"`
+	Kind    string          `json:"kind"`
+	Title   string          `json:"title"`
+	Groups  int             `json:"groups"`
+	Results []*resultRecord `json:"results"`
+}
+
+type resultRecord struct {
+	Channel  string `json:"channel"`
+	Target   string `json:"target"`
+	Outcome  string `json:"outcome"`
+	Latency  string `json:"latency"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// notifications 最近发送的通知, 会被管理接口并发访问
+type notifications struct {
+	mu   sync.Mutex
+	list []*notification
+}
+
+func (n *notifications) add(msg *consumer.Message, results consumer.Results) {
+	item := &notification{
+		Time:    time.Now(),
+		Kind:    msg.Kind,
+		Title:   msg.Title,
+		Groups:  len(msg.Groups) + len(msg.Resolved),
+		Results: make([]*resultRecord, 0, len(results)),
+	}
+	for _, result := range results {
+		record := &resultRecord{
+			Channel:  result.Channel,
+			Target:   result.Target,
+			Outcome:  result.Outcome,
+			Latency:  result.Latency.String(),
+			Response: result.Response,
+		}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+		}
+		item.Results = append(item.Results, record)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.list = append(n.list, item)
+	if len(n.list) > recentNotifications {
+		n.list = n.list[len(n.list)-recentNotifications:]
+	}
+}
+
+// all 按时间倒序
+func (n *notifications) all() []*notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	result := make([]*notification, 0, len(n.list))
+	for idx := len(n.list) - 1; idx >= 0; idx-- {
+		result = append(result, n.list[idx])
+	}
+	return result
+}
+
+type ruleRecord struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	Level    int    `json:"level"`
+	Mutex    bool   `json:"mutex"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Duration int64  `json:"duration"`
+	Times    int    `json:"times"`
+}
+
+// registerAdmin 管理接口, job 参数为空时, 查询接口返回全部 job
+//
+//	GET    /api/groups              仍在报警的分组
+//	GET    /api/rules               规则
+//	GET    /api/notifications       最近的通知
+//	POST   /api/check               立即检查
+//	GET    /api/silences            屏蔽
+//	POST   /api/silences            添加屏蔽, body 为 Silence
+//	DELETE /api/silences?id=xxx     删除屏蔽
+func (s *Server) registerAdmin() {
+	s.mux.HandleFunc("/api/groups", s.auth(s.groups))
+	s.mux.HandleFunc("/api/rules", s.auth(s.rules))
+	s.mux.HandleFunc("/api/notifications", s.auth(s.notifications))
+	s.mux.HandleFunc("/api/check", s.auth(s.check))
+	s.mux.HandleFunc("/api/silences", s.auth(s.silences))
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if len(s.conf.Token) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte("Bearer "+s.conf.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// jobs 根据 job 参数选择 processor, single 为 true 时必须确定唯一的 job
+func (s *Server) jobs(w http.ResponseWriter, r *http.Request, single bool) ([]*Processor, bool) {
+	name := r.URL.Query().Get("job")
+	if len(name) == 0 {
+		if single && len(s.processors) != 1 {
+			writeError(w, http.StatusBadRequest, "job is required")
+			return nil, false
+		}
+		return s.processors, true
+	}
+	for _, p := range s.processors {
+		if p.conf.Name == name {
+			return []*Processor{p}, true
+		}
+	}
+	writeError(w, http.StatusNotFound, "job "+name+" not found")
+	return nil, false
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+	return false
+}
+
+func (s *Server) groups(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	processors, ok := s.jobs(w, r, false)
+	if !ok {
+		return
+	}
+	type record struct {
+		Updated *time.Time     `json:"updated,omitempty"`
+		Groups  []*activeGroup `json:"groups"`
+	}
+	result := make(map[string]*record, len(processors))
+	for _, p := range processors {
+		updated, list := p.active.get()
+		result[p.conf.Name] = &record{Updated: timePtr(updated), Groups: list}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) rules(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	processors, ok := s.jobs(w, r, false)
+	if !ok {
+		return
+	}
+	result := make(map[string][]*ruleRecord, len(processors))
+	for _, p := range processors {
+		list := make([]*ruleRecord, 0, len(p.conf.Rules))
+		for id, item := range p.conf.Rules {
+			list = append(list, &ruleRecord{
+				ID:       id,
+				Name:     item.Name,
+				Content:  item.Content,
+				Level:    item.Level,
+				Mutex:    item.Mutex,
+				Start:    item.Start,
+				End:      item.End,
+				Duration: item.Duration,
+				Times:    item.Times,
+			})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].ID < list[j].ID
+		})
+		result[p.conf.Name] = list
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) notifications(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	processors, ok := s.jobs(w, r, false)
+	if !ok {
+		return
+	}
+	result := make(map[string][]*notification, len(processors))
+	for _, p := range processors {
+		result[p.conf.Name] = p.router.recent.all()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// check 已经有等待执行的检查时, queued 为 false
+func (s *Server) check(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	processors, ok := s.jobs(w, r, false)
+	if !ok {
+		return
+	}
+	result := make(map[string]bool, len(processors))
+	for _, p := range processors {
+		result[p.conf.Name] = p.Trigger()
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"queued": result})
+}
+
+// silences 新增与删除的屏蔽在下一次检查时生效, 并保存到 state 中
+func (s *Server) silences(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	processors, ok := s.jobs(w, r, r.Method != http.MethodGet)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		result := make(map[string][]*Silence, len(processors))
+		for _, p := range processors {
+			result[p.conf.Name] = p.silences.all()
+		}
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		item := new(Silence)
+		err := json.NewDecoder(r.Body).Decode(item)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		item, err = processors[0].silences.add(item)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, item)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if !processors[0].silences.remove(id) {
+			writeError(w, http.StatusNotFound, "silence "+id+" not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,40 @@
+package flr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+)
+
+func TestAdminAuth(t *testing.T) {
+	p, _ := newTestProcessor(t, new(config.Job))
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"without bearer", "secret", "secret", http.StatusUnauthorized},
+		{"right token", "secret", "Bearer secret", http.StatusOK},
+		// 未配置 token 时拒绝所有请求
+		{"token not configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(&config.HTTP{Admin: true, Token: tt.token}, []*Processor{p})
+			r := httptest.NewRequest(http.MethodGet, "/api/silences", nil)
+			if len(tt.header) > 0 {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.mux.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package flr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+	"github.com/LukeEuler/funnel-log-reporter/source"
+)
+
+// workAggregation 由数据源完成分组统计, 适用于大数据量场景
+// 此模式下 rules 不生效, 分组内日志数量达到 min_count 即报警
+func (p *Processor) workAggregation() error {
+	conf := p.conf
+	aggregator, ok := p.producer.(source.Aggregator)
+	if !ok {
+		return errors.Errorf("source %s does not support aggregation", conf.GetSourceType())
+	}
+
+	endTime := time.Now().UnixMilli()
+	beginTime := endTime - conf.Duration*1000
+
+	groupKeys := groupKeyNames(conf.GroupKeys)
+	// 样例日志只返回 show_keys, 以及屏蔽条件需要匹配的字段
+	sampleKeys := appendUnique(appendUnique(nil, conf.ShowKeys...), p.silences.matchKeys()...)
+	begin := time.Now()
+	buckets, truncated, err := aggregator.AggregateByRange(beginTime, endTime, groupKeys, sampleKeys)
+	queryDuration.WithLabelValues(conf.Name).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		return err
+	}
+	// 聚合模式下为分组的数量
+	documentsFetched.WithLabelValues(conf.Name).Observe(float64(len(buckets)))
+
+	minCount := conf.Es.MinCount
+	if minCount < 1 {
+		minCount = 1
+	}
+	total := 0
+	validBuckets := make([]*source.Bucket, 0, len(buckets))
+	for _, item := range buckets {
+		total += item.Count
+		if item.Count >= minCount {
+			validBuckets = append(validBuckets, item)
+		}
+	}
+
+	log.Entry.Warnf("[%s] get %d groups, %d message", conf.Name, len(buckets), total)
+
+	if len(validBuckets) == 0 {
+		validEventsGauge.WithLabelValues(conf.Name).Set(0)
+		groupsGauge.WithLabelValues(conf.Name).Set(0)
+		p.noEvent()
+		return nil
+	}
+
+	validTotal := 0
+	change := false
+	silenced := 0
+	groups := make([]*consumer.Group, 0, len(validBuckets))
+	groupEventsRecord := make(map[string]int64, len(validBuckets))
+	for _, item := range validBuckets {
+		validTotal += item.Count
+		if item.LastTime > p.lastEventTime {
+			p.lastEventTime = item.LastTime
+			change = true
+		}
+
+		sample := item.Sample
+		getValue := func(key string) (string, bool) {
+			value := gjson.GetBytes(sample, key)
+			return value.String(), value.Exists()
+		}
+		group := newGroup(bucketTag(item, groupKeys), item.Count, item.LastTime, conf.ShowKeys, getValue)
+		group.Keys = groupKeys
+		if p.silences.silenced(group, getValue) {
+			// 已报警的分组由 resolve 发送恢复
+			silenced++
+			continue
+		}
+		// 聚合模式下只有窗口内的数量, 按数量的增量估算
+		p.accumulate(group, func(prev *consumer.Group) int {
+			if group.LastTime <= prev.LastTime {
+				return 0
+			}
+			return max(group.Count-prev.Count, 0)
+		})
+		groups = append(groups, group)
+		groupEventsRecord[group.Tag] = item.LastTime
+	}
+	log.Entry.Warnf("[%s] %d groups needs report", conf.Name, len(validBuckets))
+	validEventsGauge.WithLabelValues(conf.Name).Set(float64(validTotal))
+	groupsGauge.WithLabelValues(conf.Name).Set(float64(len(groups)))
+	defer p.escalate(groups)
+	p.resolve(groups)
+
+	if !change {
+		return nil
+	}
+	if !p.checkAndReplaceGroupLogsRecord(groupEventsRecord) {
+		return nil
+	}
+
+	sortGroups(groups)
+
+	duration := time.Duration(conf.Duration) * time.Second
+	interval := time.Duration(conf.CheckInterval) * time.Second
+	title := fmt.Sprintf("错误: %d/%d(有效/总数) in %s. interval %s",
+		validTotal, total, duration.String(), interval.String())
+	footer := silencedFooter(silenced)
+	if truncated {
+		title += " (truncated)"
+		footer = joinLines(footer, "注意: 分组数量超过单次查询上限, 本次结果已截断")
+	}
+	// 发送失败的 target 已写入 outbox 等待重试, 只记录错误
+	err = p.sendAlert(title, groups, footer)
+	if err != nil {
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+	}
+
+	p.lastLogs = validTotal
+	p.fire(groups)
+	return nil
+}
+
+// bucketTag 与 handleEvents 中的 groupTag 格式一致
+func bucketTag(bucket *source.Bucket, groupKeys []string) string {
+	groupTags := make([]string, 0, len(groupKeys))
+	for idx, key := range groupKeys {
+		if bucket.Missing[idx] {
+			groupTags = append(groupTags, "unknow "+key)
+			continue
+		}
+		groupTags = append(groupTags, bucket.Values[idx])
+	}
+	return strings.Join(groupTags, sep)
+}
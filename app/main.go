@@ -18,14 +18,23 @@ func main() {
 	configFile := flag.String("c", "config.toml", "set the config file path")
 	flag.Parse()
 
-	config.New(*configFile)
+	conf := config.New(*configFile)
 
-	p, err := flr.NewProcessor()
-	if err != nil {
-		log.Entry.WithError(err).Fatal(err)
+	jobs := make([]func(chan struct{}), 0, len(conf.GetJobs())+1)
+	processors := make([]*flr.Processor, 0, len(conf.GetJobs()))
+	for _, job := range conf.GetJobs() {
+		p, err := flr.NewProcessor(job)
+		if err != nil {
+			log.Entry.WithError(err).WithField("job", job.Name).Fatal(err)
+		}
+		jobs = append(jobs, p.Loop)
+		processors = append(processors, p)
+	}
+	if len(conf.HTTP.Listen) > 0 {
+		jobs = append(jobs, flr.NewServer(&conf.HTTP, processors).Loop)
 	}
 
-	doLoopJobs(p.Loop)
+	doLoopJobs(jobs...)
 }
 
 func doLoopJobs(jobs ...func(chan struct{})) {
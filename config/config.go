@@ -2,34 +2,140 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/LukeEuler/funnel/common"
 	"github.com/LukeEuler/funnel/model"
+	"github.com/pkg/errors"
 
 	"github.com/LukeEuler/funnel-log-reporter/es"
 	"github.com/LukeEuler/funnel-log-reporter/log"
 )
 
-var Conf *Config
-
-func New(configPath string) {
-	Conf = new(Config)
-	_, err := toml.DecodeFile(configPath, Conf)
+func New(configPath string) *Config {
+	conf := new(Config)
+	_, err := toml.DecodeFile(configPath, conf)
 	if err != nil {
 		log.Entry.Fatal(err)
 	}
+	err = conf.check()
+	if err != nil {
+		log.Entry.Fatal(err)
+	}
+	return conf
 }
 
 type Config struct {
+	// 兼容只有一个任务的旧配置, 没有 [[jobs]] 时使用
+	Job
+	Jobs []*Job `toml:"jobs"`
+	// 可选的 HTTP 服务, 所有 job 共用
+	HTTP HTTP `toml:"http"`
+}
+
+type HTTP struct {
+	Listen string `toml:"listen"` // 例如 :9100, 为空时不启动
+	// 超过 stale_cycles 个 check_interval_s 没有完成检查时, /healthz 与 /readyz 返回 503, 默认 3
+	StaleCycles int64 `toml:"stale_cycles"`
+	// 管理接口, 可以查询分组/规则/通知, 立即检查, 以及管理屏蔽
+	Admin bool   `toml:"admin"`
+	Token string `toml:"token"` // 管理接口的 Bearer token, 开启管理接口时必须配置
+}
+
+func (h *HTTP) GetStaleCycles() int64 {
+	if h.StaleCycles <= 0 {
+		return 3
+	}
+	return h.StaleCycles
+}
+
+// GetJobs 每个 job 对应一个独立的 Processor
+func (c *Config) GetJobs() []*Job {
+	if len(c.Jobs) > 0 {
+		return c.Jobs
+	}
+	if len(c.Job.Name) == 0 {
+		c.Job.Name = "default"
+	}
+	return []*Job{&c.Job}
+}
+
+func (c *Config) check() error {
+	// 管理接口可以触发检查与修改屏蔽, 且与 /metrics 共用端口
+	if c.HTTP.Admin && len(c.HTTP.Token) == 0 {
+		return errors.New("http.token is required when http.admin is enabled")
+	}
+
+	names := make(map[string]bool)
+	statePaths := make(map[string]string)
+	for idx, job := range c.GetJobs() {
+		if len(job.Name) == 0 {
+			return errors.Errorf("name of jobs[%d] is empty", idx)
+		}
+		if names[job.Name] {
+			return errors.Errorf("duplicate job name %s", job.Name)
+		}
+		names[job.Name] = true
+
+		if len(job.State.Path) == 0 {
+			continue
+		}
+		if other, ok := statePaths[job.State.Path]; ok {
+			return errors.Errorf("job %s and %s use the same state path %s", other, job.Name, job.State.Path)
+		}
+		statePaths[job.State.Path] = job.Name
+	}
+
+	for _, job := range c.GetJobs() {
+		for key := range job.Levels {
+			_, err := strconv.Atoi(key)
+			if err != nil {
+				return errors.Errorf("levels.%s in job %s is not a number", key, job.Name)
+			}
+		}
+		// 聚合模式下由数据源按字段分组, 每个分组字段只能有一个候选字段
+		if job.Es.Aggregation {
+			for idx, keys := range job.GroupKeys {
+				if len(keys) != 1 {
+					return errors.Errorf("group_keys[%d] in job %s needs exactly one key in es aggregation mode", idx, job.Name)
+				}
+			}
+		}
+		for idx, route := range job.Routes {
+			for _, name := range route.Channels {
+				if _, ok := job.GetChannels()[name]; !ok {
+					return errors.Errorf("channel %s in job %s routes[%d] not found", name, job.Name, idx)
+				}
+			}
+		}
+		if job.Escalation != nil {
+			for idx, tier := range job.Escalation.Tiers {
+				if tier.After <= 0 && tier.Cycles <= 0 {
+					return errors.Errorf("escalation tiers[%d] in job %s needs after_s or cycles", idx, job.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type Job struct {
+	Name          string     `toml:"name"`
 	CheckInterval int64      `toml:"check_interval_s"` // 最小 10s
 	Duration      int64      `toml:"duration_s"`
 	GroupKeys     [][]string `toml:"group_keys"`
 	ShowKeys      []string   `toml:"show_keys"`
 	TimeKey       []string   `toml:"time_key"`
 	Hi            bool       `toml:"hi"`
-	Custom        struct {
+	// 每个 rule level 单独发送一条报警消息
+	SplitByLevel bool `toml:"split_by_level"`
+	// 按 rule level 定制报警消息, key 为 level
+	Levels map[string]*Level `toml:"levels"`
+	Custom struct {
 		HiTitle               string `toml:"hi_title"`
 		HiColor               string `toml:"hi_color"`
 		HiContent             string `toml:"hi_content"`
@@ -40,31 +146,186 @@ type Config struct {
 		RecoverTitle          string `toml:"recover_title"`
 		RecoverColor          string `toml:"recover_color"`
 	} `toml:"custom"`
-	Es struct {
+	Source string `toml:"source"` // es(默认), file
+	Es     struct {
 		Address       []string `toml:"address"`
 		Username      string   `toml:"username"`
 		Password      string   `toml:"password"`
 		Index         string   `toml:"index"`
-		Size          int      `toml:"size"`
+		Size          int      `toml:"size"`     // 每页数量
+		MaxDocs       int      `toml:"max_docs"` // 每次查询最多获取的数量, 默认 10000
 		RangeTimeName string   `toml:"range_time_name"`
-		Term          []struct {
+		// 由 es 完成分组统计, 不再拉取全部日志, 此时 rules 不生效
+		Aggregation bool `toml:"aggregation"`
+		MinCount    int  `toml:"min_count"` // 分组内日志数量达到该值才报警, 默认 1
+		Term        []struct {
 			Key    string   `toml:"key"`
 			Values []string `toml:"values"`
 		} `toml:"term"`
 	} `toml:"es"`
-	Ding struct {
+	File struct {
+		Path          string `toml:"path"` // 支持通配符, 每行一条 json 日志
+		RangeTimeName string `toml:"range_time_name"`
+	} `toml:"file"`
+	// 默认的通知目标, 即名为 default 的 channel
+	Targets
+	// 其他命名的通知目标, 配合 routes 使用, 如 [channels.eth.lark]
+	Channels map[string]*Targets `toml:"channels"`
+	// 按规则或分组选择 channel, 未匹配任何路由的分组发送到 default
+	Routes []*Route `toml:"routes"`
+	// 静默时段, 也可以在 route 中单独配置
+	Quiet *QuietHours `toml:"quiet"`
+	// 分组持续报警时, 逐级 @ 更多的人员, 直到恢复
+	Escalation *Escalation `toml:"escalation"`
+	// 屏蔽, 也可以通过管理接口添加, 均保存在 state 中
+	Silences []*Silence `toml:"silences"`
+	State    struct {
+		Path string `toml:"path"` // 为空时不持久化
+	} `toml:"state"`
+
+	Rules map[string]*rule `toml:"rules"`
+}
+
+// Targets 一组通知目标
+type Targets struct {
+	// 每个 target 单独限流, per_minute 为 0 时不限流
+	// 被限流的通知不会重发, 数量在之后的通知中汇总提示
+	RateLimit struct {
+		PerMinute float64 `toml:"per_minute"`
+		Burst     int     `toml:"burst"` // 默认与 per_minute 相同
+	} `toml:"rate_limit"`
+	// 发送失败的通知按指数退避重试, 配置 state.path 时重启后继续重试
+	Retry struct {
+		MaxAttempts int   `toml:"max_attempts"`  // 默认 10, 为 1 时不重试
+		MaxBackoff  int64 `toml:"max_backoff_s"` // 默认 30m
+	} `toml:"retry"`
+	// 所有 target 都发送失败时, 再发送到 fallback 中的 target, fallback 中也可以配置 fallback
+	Fallback *Targets `toml:"fallback"`
+	Ding     struct {
 		Enable  bool     `toml:"enable"`
 		URL     string   `toml:"url"`
 		Secret  string   `toml:"secret"`
 		Mobiles []string `toml:"mobiles"`
 	} `toml:"ding"`
 	Lark struct {
+		Enable  bool     `toml:"enable"`
+		URL     string   `toml:"url"`
+		Secret  string   `toml:"secret"`
+		UserIDs []string `toml:"user_ids"` // at someones, open id
+	} `toml:"lark"`
+	Slack struct {
+		Enable bool     `toml:"enable"`
+		URL    string   `toml:"url"`
+		Users  []string `toml:"users"`  // at someones, user id
+		Groups []string `toml:"groups"` // at user groups, user group id
+	} `toml:"slack"`
+	Email struct {
+		Enable   bool     `toml:"enable"`
+		Host     string   `toml:"host"`
+		Port     int      `toml:"port"`
+		Username string   `toml:"username"`
+		Password string   `toml:"password"`
+		TLS      string   `toml:"tls"`  // starttls(默认), tls, none
+		From     string   `toml:"from"` // 默认为 username
+		To       []string `toml:"to"`
+	} `toml:"email"`
+	Telegram struct {
+		Enable    bool     `toml:"enable"`
+		Token     string   `toml:"token"`
+		ChatIDs   []string `toml:"chat_ids"`
+		ParseMode string   `toml:"parse_mode"` // HTML(默认), MarkdownV2
+	} `toml:"telegram"`
+	Teams struct {
 		Enable bool   `toml:"enable"`
 		URL    string `toml:"url"`
-		Secret string `toml:"secret"`
-	} `toml:"lark"`
+	} `toml:"teams"`
+	Wecom struct {
+		Enable  bool     `toml:"enable"`
+		URL     string   `toml:"url"`
+		Mobiles []string `toml:"mobiles"`
+	} `toml:"wecom"`
+	PagerDuty struct {
+		Enable     bool   `toml:"enable"`
+		RoutingKey string `toml:"routing_key"` // Events API v2 integration key
+		Severity   string `toml:"severity"`    // critical, error(默认), warning, info
+	} `toml:"pagerduty"`
+	Alertmanager struct {
+		Enable    bool     `toml:"enable"`
+		URLs      []string `toml:"urls"`
+		AlertName string   `toml:"alert_name"` // 默认 LogError
+	} `toml:"alertmanager"`
+	Webhook struct {
+		Enable  bool              `toml:"enable"`
+		URL     string            `toml:"url"`
+		Method  string            `toml:"method"` // 默认 POST
+		Headers map[string]string `toml:"headers"`
+		// text/template 模板, 数据包括 .Title .Color .Content .Notify .Groups
+		Body string `toml:"body"`
+	} `toml:"webhook"`
+}
 
-	Rules map[string]*rule `toml:"rules"`
+// Level 报警消息中等级最高的规则决定使用哪个 Level
+type Level struct {
+	Color       string `toml:"color"`
+	TitlePrefix string `toml:"title_prefix"`
+	Notify      *bool  `toml:"notify"` // 是否 @ 相关人员, 默认 true
+	Mentions
+}
+
+// Mentions 除通知目标的配置之外, 额外 @ 的人员
+type Mentions struct {
+	Mobiles     []string `toml:"mobiles"`       // ding, wecom 的手机号
+	LarkUserIDs []string `toml:"lark_user_ids"` // lark 的 open id
+	SlackUsers  []string `toml:"slack_users"`   // slack 的 user id
+	SlackGroups []string `toml:"slack_groups"`  // slack 的 user group id
+}
+
+// Silence 条件需要同时满足: rules 中的任意一个, 以及 match 中的全部字段
+type Silence struct {
+	ID      string            `toml:"id"`
+	Rules   []string          `toml:"rules"`
+	Match   map[string]string `toml:"match"` // 日志字段的值, 不限于 group_keys
+	Start   time.Time         `toml:"start"`
+	End     time.Time         `toml:"end"`
+	Comment string            `toml:"comment"`
+}
+
+// Route 同一个路由内的条件需要同时满足, 每个条件内满足其中一个即可
+type Route struct {
+	Rules    []string          `toml:"rules"`  // rule id
+	Levels   []int             `toml:"levels"` // rule level
+	Match    map[string]string `toml:"match"`  // group_keys 的值
+	Channels []string          `toml:"channels"`
+	Continue bool              `toml:"continue"` // 匹配后是否继续匹配后续路由
+	Mentions
+	// 为空时使用 job 的静默时段
+	Quiet *QuietHours `toml:"quiet"`
+}
+
+// Escalation 分组持续报警达到 tier 的条件时, 重新发送报警并 @ 该 tier 的人员
+// tiers 按顺序逐级升级, 每个 tier 只通知一次
+type Escalation struct {
+	Tiers []*EscalationTier `toml:"tiers"`
+}
+
+// EscalationTier after_s 与 cycles 满足其一即可
+type EscalationTier struct {
+	After  int64 `toml:"after_s"` // 持续报警的时间
+	Cycles int   `toml:"cycles"`  // 持续报警的检查周期数
+	Mentions
+}
+
+// QuietHours 静默时段内, 非紧急的报警会被缓存, 静默结束后汇总发送
+type QuietHours struct {
+	Timezone    string         `toml:"timezone"`     // 默认为本地时区
+	BypassLevel int            `toml:"bypass_level"` // level <= bypass_level 的报警不受影响, 默认 0
+	Windows     []*QuietWindow `toml:"windows"`
+}
+
+type QuietWindow struct {
+	Weekdays []string `toml:"weekdays"` // mon, tue ... sun, 为空时表示每天
+	Start    string   `toml:"start"`    // hh:mm
+	End      string   `toml:"end"`      // hh:mm, 小于 start 时跨越午夜
 }
 
 type rule struct {
@@ -96,10 +357,51 @@ func (r *rule) toEventRuleInfo(id string) *common.EventRuleInfo {
 	}
 }
 
-func (c *Config) ToEsConfig() *es.Config {
+func (c *Job) GetLevel(level int) *Level {
+	return c.Levels[strconv.Itoa(level)]
+}
+
+const DefaultChannel = "default"
+
+// GetChannels 包含 default
+func (c *Job) GetChannels() map[string]*Targets {
+	result := make(map[string]*Targets, len(c.Channels)+1)
+	for name, item := range c.Channels {
+		result[name] = item
+	}
+	result[DefaultChannel] = &c.Targets
+	return result
+}
+
+func (c *Job) GetSourceType() string {
+	if len(c.Source) == 0 {
+		return "es"
+	}
+	return c.Source
+}
+
+// GetOutboxPath 等待发送的通知单独保存, 例如 data/state.json 对应 data/state.outbox.json
+func (c *Job) GetOutboxPath() string {
+	if len(c.State.Path) == 0 {
+		return ""
+	}
+	ext := filepath.Ext(c.State.Path)
+	return strings.TrimSuffix(c.State.Path, ext) + ".outbox" + ext
+}
+
+// GetRangeTimeName 日志中表示时间的字段, 用于增量查询
+func (c *Job) GetRangeTimeName() string {
+	if c.GetSourceType() == "file" {
+		return c.File.RangeTimeName
+	}
+	return c.Es.RangeTimeName
+}
+
+func (c *Job) ToEsConfig() *es.Config {
 	esConf := &es.Config{
 		Index:         c.Es.Index,
 		Size:          c.Es.Size,
+		MaxDocs:       c.Es.MaxDocs,
 		RangeTimeName: c.Es.RangeTimeName,
 		Terms:         make([]*es.Term, 0, len(c.Es.Term)),
 	}
@@ -113,7 +415,7 @@ func (c *Config) ToEsConfig() *es.Config {
 	return esConf
 }
 
-func (c *Config) GetRules() []model.EventRule {
+func (c *Job) GetRules() []model.EventRule {
 	result := make([]model.EventRule, 0, len(c.Rules))
 	for id, item := range c.Rules {
 		temp := item.toEventRuleInfo(id)
@@ -122,7 +424,7 @@ func (c *Config) GetRules() []model.EventRule {
 	return result
 }
 
-func (c *Config) GetBaseQueryTimeInfo() string {
+func (c *Job) GetBaseQueryTimeInfo() string {
 	duration := time.Duration(c.Duration) * time.Second
 	interval := time.Duration(c.CheckInterval) * time.Second
 	return fmt.Sprintf("每次日志查询的时间范围: %s\n每次查询的时间间隔: %s\n",
@@ -0,0 +1,168 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAlertName = "LogError"
+	defaultEndsAfter = time.Hour
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// alertmanager 每个分组对应一个 alert
+// 报警消息只在分组有新的日志时发送, endsAt 覆盖到下一次发送或者分组恢复的时间, 避免被 resolve_timeout 自动恢复
+// labels 只包括 job 与 group_keys, 规则信息会变化, 放在 annotations 中, 避免 fingerprint 变化
+type alertmanager struct {
+	urls      []string
+	alertName string
+	endsAfter time.Duration
+}
+
+func newAlertmanager(urls []string, alertName string, endsAfter time.Duration) *alertmanager {
+	if len(alertName) == 0 {
+		alertName = defaultAlertName
+	}
+	if endsAfter <= 0 {
+		endsAfter = defaultEndsAfter
+	}
+	list := make([]string, 0, len(urls))
+	for _, item := range urls {
+		list = append(list, strings.TrimRight(item, "/")+"/api/v2/alerts")
+	}
+	return &alertmanager{
+		urls:      list,
+		alertName: alertName,
+		endsAfter: endsAfter,
+	}
+}
+
+func (*alertmanager) textless() {}
+
+func (a *alertmanager) Send(msg *Message) (string, error) {
+	now := time.Now()
+	var (
+		groups []*Group
+		endsAt time.Time
+	)
+	switch msg.Kind {
+	case KindAlert:
+		groups, endsAt = msg.Groups, now.Add(a.endsAfter)
+	case KindRecover:
+		groups, endsAt = msg.Resolved, now
+	default:
+		return "", nil
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
+
+	alerts := make([]*alert, 0, len(groups))
+	for _, item := range groups {
+		alerts = append(alerts, a.newAlert(msg, item, now, endsAt))
+	}
+	bs, _ := json.Marshal(alerts)
+
+	// 多个地址用于 alertmanager 集群, 任意一个成功即可
+	var result error
+	for _, url := range a.urls {
+		response, err := a.send(url, bs)
+		if err == nil {
+			return response, nil
+		}
+		result = err
+	}
+	return "", result
+}
+
+// newAlert startsAt 为分组第一次报警的时间, 第一次报警时还没有记录, 使用当前时间
+func (a *alertmanager) newAlert(msg *Message, group *Group, now, endsAt time.Time) *alert {
+	labels := map[string]string{
+		"alertname": a.alertName,
+	}
+	if len(msg.Job) > 0 {
+		labels["job"] = msg.Job
+	}
+	for idx, key := range group.Keys {
+		if idx < len(group.Values) {
+			labels[labelName(key)] = group.Values[idx]
+		}
+	}
+
+	annotations := map[string]string{
+		"summary": msg.Title,
+		"count":   strconv.Itoa(group.Count),
+	}
+	for _, item := range group.Fields {
+		if !item.Missing {
+			annotations[labelName(item.Key)] = strings.TrimSpace(item.Value)
+		}
+	}
+	if len(group.RuleID) > 0 {
+		annotations["rule_id"] = group.RuleID
+		annotations["rule"] = group.RuleName
+		annotations["level"] = strconv.Itoa(group.Level)
+	}
+
+	startsAt := now
+	if group.Since > 0 {
+		startsAt = time.UnixMilli(group.Since)
+	}
+	return &alert{
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    startsAt.Format(time.RFC3339),
+		EndsAt:      endsAt.Format(time.RFC3339),
+	}
+}
+
+// labelName label 只能包含 [a-zA-Z0-9_], 且不能以数字开头
+func labelName(key string) string {
+	name := invalidLabelChars.ReplaceAllString(key, "_")
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func (a *alertmanager) send(url string, bs []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(bs))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(retryAfter(resp), "alertmanager response %s: %s", resp.Status, result)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("alertmanager response %s: %s", resp.Status, result)
+	}
+	return string(result), nil
+}
+
+// https://github.com/prometheus/alertmanager/blob/main/api/v2/openapi.yaml
+type alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
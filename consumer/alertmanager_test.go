@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAlertmanagerSend(t *testing.T) {
+	var alerts []*alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		alerts = nil
+		_ = json.NewDecoder(r.Body).Decode(&alerts)
+	}))
+	defer server.Close()
+
+	a := newAlertmanager([]string{server.URL + "/"}, "", 10*time.Minute)
+	since := time.Now().Add(-time.Hour).Truncate(time.Second)
+	group := &Group{
+		Tag:      "eth/node",
+		Keys:     []string{"chain", "k8s.pod"},
+		Values:   []string{"eth", "node-0"},
+		Count:    3,
+		LastTime: time.Now().UnixMilli(),
+		Fields:   []*Field{{Key: "message", Value: " boom "}, {Key: "host", Missing: true}},
+		RuleID:   "0_1",
+		RuleName: "panic",
+		Level:    1,
+		Since:    since.UnixMilli(),
+	}
+	labels := map[string]string{
+		"alertname": defaultAlertName,
+		"job":       "test",
+		"chain":     "eth",
+		"k8s_pod":   "node-0",
+	}
+
+	begin := time.Now().Truncate(time.Second)
+	_, err := a.Send(&Message{Job: "test", Kind: KindAlert, Title: "title", Groups: []*Group{group}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("alerts = %+v, want one", alerts)
+	}
+	item := alerts[0]
+	// 规则信息不在 labels 中, 升级或者规则变化时 fingerprint 不变
+	if !reflect.DeepEqual(item.Labels, labels) {
+		t.Fatalf("labels = %v, want %v", item.Labels, labels)
+	}
+	if item.Annotations["rule_id"] != "0_1" || item.Annotations["level"] != "1" || item.Annotations["message"] != "boom" {
+		t.Fatalf("annotations = %v", item.Annotations)
+	}
+	if _, ok := item.Annotations["host"]; ok {
+		t.Fatalf("missing field should not be an annotation: %v", item.Annotations)
+	}
+	if item.StartsAt != since.Format(time.RFC3339) {
+		t.Fatalf("startsAt = %s, want %s", item.StartsAt, since.Format(time.RFC3339))
+	}
+	endsAt, _ := time.Parse(time.RFC3339, item.EndsAt)
+	if endsAt.Before(begin.Add(10*time.Minute)) || endsAt.After(time.Now().Add(10*time.Minute)) {
+		t.Fatalf("endsAt = %s, want about 10m later", item.EndsAt)
+	}
+
+	_, err = a.Send(&Message{Job: "test", Kind: KindRecover, Resolved: []*Group{group}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || !reflect.DeepEqual(alerts[0].Labels, labels) {
+		t.Fatalf("resolved alerts = %+v, want the same labels", alerts)
+	}
+	endsAt, _ = time.Parse(time.RFC3339, alerts[0].EndsAt)
+	if endsAt.After(time.Now()) {
+		t.Fatalf("resolved endsAt = %s, want now", alerts[0].EndsAt)
+	}
+}
@@ -1,32 +1,249 @@
 package consumer
 
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	KindInfo    = "info" // 启动, 心跳等
+	KindAlert   = "alert"
+	KindRecover = "recover"
+)
+
+// Message 一次通知的内容
+type Message struct {
+	Job     string   `json:"job"`
+	Kind    string   `json:"kind"`
+	Title   string   `json:"title"`
+	Color   string   `json:"color"`
+	Content string   `json:"content"`
+	Footer  string   `json:"footer,omitempty"` // Content 末尾的提示, 已包含在 Content 中
+	Notify  bool     `json:"notify"`           // 是否 @ 相关人员
+	Groups  []*Group `json:"groups"`           // 报警的分组, 恢复/心跳等消息为空
+	// 已恢复的分组, 仅用于恢复消息
+	Resolved []*Group `json:"resolved,omitempty"`
+
+	// 除 target 配置之外, 额外 @ 的人员, 仅在 Notify 为 true 时生效
+	Mobiles     []string `json:"mobiles,omitempty"`       // ding, wecom
+	LarkUserIDs []string `json:"lark_user_ids,omitempty"` // lark
+	SlackUsers  []string `json:"slack_users,omitempty"`   // slack user id
+	SlackGroups []string `json:"slack_groups,omitempty"`  // slack user group id
+}
+
+// Group 一个报警分组
+type Group struct {
+	Tag      string   `json:"tag"`    // 分组标识
+	Keys     []string `json:"keys"`   // group_keys 的名称
+	Values   []string `json:"values"` // group_keys 对应的值
+	Count    int      `json:"count"`
+	LastTime int64    `json:"last_time"` // 毫秒
+	Fields   []*Field `json:"fields"`
+
+	// 分组内等级最高的规则, 聚合模式下为空
+	RuleID   string `json:"rule_id,omitempty"`
+	RuleName string `json:"rule_name,omitempty"`
+	Level    int    `json:"level"`
+
+	// 第一次报警的时间(毫秒), 以及报警期间的日志总数
+	Since int64 `json:"since,omitempty"`
+	Total int   `json:"total,omitempty"`
+}
+
+// Field show_keys 对应的值, 取自分组内最新的一条日志
+type Field struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+func (g *Group) String() string {
+	buffer := bytes.NewBufferString("")
+	buffer.WriteString(fmt.Sprintf("%v errors %d\n", g.Values, g.Count))
+	for _, item := range g.Fields {
+		if item.Missing {
+			buffer.WriteString(fmt.Sprintf("%s -\n", item.Key))
+		} else {
+			buffer.WriteString(fmt.Sprintf("%s: %s\n", item.Key, strings.TrimSpace(item.Value)))
+		}
+	}
+	return buffer.String()
+}
+
+// target Send 返回厂商的响应内容
+type target interface {
+	Send(msg *Message) (string, error)
+}
+
 type Consumer struct {
-	larkEnable, dingEnable bool
+	names   []string
+	targets map[string]*limiter
+	// 所有 target 都发送失败时, 依次发送到下一级 fallback 的 target
+	fallbacks [][]string
+
+	perMinute float64
+	burst     int
+
+	// 等待发送的通知, 发送失败的在 Flush 时重试
+	pending     []*Pending
+	persist     func()
+	maxAttempts int
+	maxBackoff  time.Duration
+}
+
+func (c *Consumer) add(name string, t target) {
+	if c.targets == nil {
+		c.targets = make(map[string]*limiter)
+	}
+	if _, ok := c.targets[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	l := newLimiter(t)
+	l.setRate(c.perMinute, c.burst)
+	c.targets[name] = l
+}
 
-	larkClient *lark
-	dingClient *ding
+// SetRateLimit 每个 target 单独限流, perMinute 为 0 时不限流
+// burst 为 0 时与 perMinute 相同
+func (c *Consumer) SetRateLimit(perMinute float64, burst int) {
+	c.perMinute, c.burst = perMinute, burst
+	for _, l := range c.targets {
+		l.setRate(perMinute, burst)
+	}
 }
 
-func (c *Consumer) SetLark(url, secret string) {
-	c.larkClient = newLark(url, secret)
-	c.larkEnable = true
+func (c *Consumer) SetLark(url, secret string, userIDs []string) {
+	c.add("lark", newLark(url, secret, userIDs))
 }
 
 func (c *Consumer) SetDingTalk(url, secret string, mobiles []string) {
-	c.dingClient = newDing(url, secret, mobiles)
-	c.dingEnable = true
+	c.add("ding", newDing(url, secret, mobiles))
+}
+
+func (c *Consumer) SetSlack(url string, users, groups []string) {
+	c.add("slack", newSlack(url, users, groups))
 }
 
-func (c *Consumer) Send(title, color, content string, notify bool) error {
-	var dingErr, larkErr error
-	if c.larkEnable {
-		dingErr = c.larkClient.Send(title, color, content)
+func (c *Consumer) SetEmail(host string, port int, username, password, tls, from string, to []string) error {
+	e, err := newEmail(host, port, username, password, tls, from, to)
+	if err != nil {
+		return err
 	}
-	if c.dingEnable {
-		larkErr = c.dingClient.Send(title, content, notify)
+	c.add("email", e)
+	return nil
+}
+
+func (c *Consumer) SetTelegram(token string, chatIDs []string, parseMode string) error {
+	t, err := newTelegram(token, chatIDs, parseMode)
+	if err != nil {
+		return err
 	}
-	if dingErr != nil {
-		return dingErr
+	c.add("telegram", t)
+	return nil
+}
+
+func (c *Consumer) SetTeams(url string) {
+	c.add("teams", newTeams(url))
+}
+
+func (c *Consumer) SetWecom(url string, mobiles []string) {
+	c.add("wecom", newWecom(url, mobiles))
+}
+
+func (c *Consumer) SetPagerDuty(routingKey, severity string) {
+	c.add("pagerduty", newPagerDuty(routingKey, severity))
+}
+
+func (c *Consumer) SetAlertmanager(urls []string, alertName string, endsAfter time.Duration) {
+	c.add("alertmanager", newAlertmanager(urls, alertName, endsAfter))
+}
+
+func (c *Consumer) SetWebhook(url, method string, headers map[string]string, body string) error {
+	w, err := newWebhook(url, method, headers, body)
+	if err != nil {
+		return err
+	}
+	c.add("webhook", w)
+	return nil
+}
+
+// Targets 已配置的 target 名称, 包括 fallback
+func (c *Consumer) Targets() []string {
+	result := append([]string{}, c.names...)
+	for _, names := range c.fallbacks {
+		result = append(result, names...)
+	}
+	return result
+}
+
+// SetFallback 使用 f 中的 target 作为 fallback, 名称加上 fallback. 前缀
+// f 自身的 fallback 作为下一级 fallback
+func (c *Consumer) SetFallback(f *Consumer) {
+	if c.targets == nil {
+		c.targets = make(map[string]*limiter)
+	}
+	for _, names := range append([][]string{f.names}, f.fallbacks...) {
+		level := make([]string, 0, len(names))
+		for _, name := range names {
+			level = append(level, FallbackPrefix+name)
+			c.targets[FallbackPrefix+name] = f.targets[name]
+		}
+		c.fallbacks = append(c.fallbacks, level)
+	}
+}
+
+// SendMessage 发送到所有 target, 发送前写入 pending, 发送失败的 target 会在之后的 Flush 中重试
+// 所有 target 都发送失败时, 再发送到 fallback
+func (c *Consumer) SendMessage(msg *Message) Results {
+	results := c.sendAll(c.names, msg)
+	last := results
+	for _, names := range c.fallbacks {
+		if !last.failed() {
+			break
+		}
+		last = c.sendAll(names, msg)
+		results = append(results, last...)
+	}
+	return results
+}
+
+func (c *Consumer) sendAll(names []string, msg *Message) Results {
+	results := make(Results, 0, len(names))
+	if len(names) == 0 {
+		return results
+	}
+	now := time.Now()
+	items := make([]*Pending, 0, len(names))
+	for _, name := range names {
+		items = append(items, c.enqueue(name, msg, now))
+	}
+	c.save()
+	defer c.save()
+
+	for idx, name := range names {
+		result := c.targets[name].send(msg)
+		result.Target = name
+		c.settle(items[idx], result, now)
+		if result.Outcome == OutcomeSent {
+			c.resolved(name, msg)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Flush 重试发送失败的通知, 以及发送被限流通知的汇总
+func (c *Consumer) Flush() Results {
+	results := c.retry(time.Now())
+	for _, name := range c.Targets() {
+		result := c.targets[name].flush()
+		if result == nil {
+			continue
+		}
+		result.Target = name
+		results = append(results, result)
 	}
-	return larkErr
+	return results
 }
@@ -0,0 +1,45 @@
+package consumer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSendMessageFallback(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name    string
+		ding    error
+		lark    error
+		email   error
+		targets []string
+	}{
+		{"all sent", nil, nil, nil, []string{"ding", "lark"}},
+		{"one failed", boom, nil, nil, []string{"ding", "lark"}},
+		{"all failed", boom, boom, nil, []string{"ding", "lark", "fallback.email"}},
+		{"nested", boom, boom, boom, []string{"ding", "lark", "fallback.email", "fallback.fallback.teams"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nested := new(Consumer)
+			nested.add("teams", new(fakeTarget))
+			f := new(Consumer)
+			f.add("email", &fakeTarget{err: tt.email})
+			f.SetFallback(nested)
+			c := new(Consumer)
+			c.SetRetry(1, 0)
+			c.add("ding", &fakeTarget{err: tt.ding})
+			c.add("lark", &fakeTarget{err: tt.lark})
+			c.SetFallback(f)
+
+			targets := make([]string, 0)
+			for _, item := range c.SendMessage(&Message{Kind: KindAlert}) {
+				targets = append(targets, item.Target)
+			}
+			if !reflect.DeepEqual(targets, tt.targets) {
+				t.Fatalf("targets = %v, want %v", targets, tt.targets)
+			}
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -29,8 +28,8 @@ func newDing(url, secret string, mobiles []string) *ding {
 	}
 }
 
-func (d *ding) Send(title, body string, notify bool) error {
-	content := title + "\n\n" + body
+func (d *ding) Send(msg *Message) (string, error) {
+	content := msg.Title + "\n\n" + msg.Content
 
 	timestamp := time.Now().Unix() * 1000
 	stringTimestamp := strconv.FormatInt(timestamp, 10)
@@ -44,15 +43,15 @@ func (d *ding) Send(title, body string, notify bool) error {
 			Content: content,
 		},
 	}
-	if notify {
-		temp.At.AtMobiles = d.mobiles
+	if msg.Notify {
+		temp.At.AtMobiles = append(append([]string{}, d.mobiles...), msg.Mobiles...)
 	}
 
 	bs, _ := json.Marshal(temp)
 
 	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewBuffer(bs))
 	if err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 	req.Header.Add("Content-Type", "application/json")
 
@@ -61,15 +60,29 @@ func (d *ding) Send(title, body string, notify bool) error {
 	values.Set("sign", sign)
 	req.URL.RawQuery = values.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 	defer resp.Body.Close()
 
 	result, _ := io.ReadAll(resp.Body)
-	fmt.Println(string(result))
-	return nil
+	r := new(struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	})
+	err = json.Unmarshal(result, r)
+	if err != nil {
+		return "", errors.Wrapf(err, "ding response %s: %s", resp.Status, result)
+	}
+	// 130101: 发送速度太快而限流
+	if r.ErrCode == 130101 {
+		return "", newThrottledError(0, "ding response %d: %s", r.ErrCode, r.ErrMsg)
+	}
+	if r.ErrCode != 0 {
+		return "", errors.Errorf("ding response %d: %s", r.ErrCode, r.ErrMsg)
+	}
+	return string(result), nil
 }
 
 type requestBody struct {
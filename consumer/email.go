@@ -0,0 +1,221 @@
+package consumer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	EmailTLSNone     = "none"
+	EmailTLSStartTLS = "starttls"
+	EmailTLS         = "tls" // implicit tls, 一般为 465 端口
+)
+
+var emailHTML = template.Must(template.New("email").Funcs(template.FuncMap{
+	"color": rgbColor,
+	"time": func(ms int64) string {
+		return time.UnixMilli(ms).Format(time.RFC3339)
+	},
+}).Parse(`<html><body>
+<h3 style="border-left: 6px solid {{color .Color}}; padding-left: 8px;">{{.Title}}</h3>
+{{- if .Groups}}
+<table border="1" cellspacing="0" cellpadding="4" style="border-collapse: collapse;">
+<tr><th>group</th><th>count</th><th>last time</th>{{range (index .Groups 0).Fields}}<th>{{.Key}}</th>{{end}}</tr>
+{{- range .Groups}}
+<tr><td>{{range $i, $v := .Values}}{{if $i}}<br>{{end}}{{$v}}{{end}}</td><td>{{.Count}}</td><td>{{time .LastTime}}</td>
+{{- range .Fields}}<td>{{if .Missing}}-{{else}}<pre style="margin: 0;">{{.Value}}</pre>{{end}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- with .Footer}}
+<pre>{{.}}</pre>
+{{- end}}
+{{- else}}
+<pre>{{.Content}}</pre>
+{{- end}}
+</body></html>
+`))
+
+type email struct {
+	host     string
+	port     int
+	username string
+	password string
+	tls      string
+	from     string
+	to       []string
+}
+
+func newEmail(host string, port int, username, password, tlsMode, from string, to []string) (*email, error) {
+	switch tlsMode {
+	case "":
+		tlsMode = EmailTLSStartTLS
+	case EmailTLSNone, EmailTLSStartTLS, EmailTLS:
+	default:
+		return nil, errors.Errorf("unknown email tls mode %s", tlsMode)
+	}
+	if len(to) == 0 {
+		return nil, errors.New("email.to is empty")
+	}
+	if len(from) == 0 {
+		from = username
+	}
+	return &email{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		tls:      tlsMode,
+		from:     from,
+		to:       to,
+	}, nil
+}
+
+func (e *email) Send(msg *Message) (string, error) {
+	body, err := e.build(msg)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := e.dial()
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	if len(e.username) > 0 {
+		err = c.Auth(smtp.PlainAuth("", e.username, e.password, e.host))
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	err = c.Mail(e.from)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for _, item := range e.to {
+		err = c.Rcpt(item)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	_, err = w.Write(body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	err = w.Close()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return "", errors.WithStack(c.Quit())
+}
+
+func (e *email) dial() (*smtp.Client, error) {
+	address := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	tlsConfig := &tls.Config{ServerName: e.host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	if e.tls == EmailTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// 整个会话的超时
+	err = conn.SetDeadline(time.Now().Add(sendTimeout))
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.WithStack(err)
+	}
+	if e.tls == EmailTLSStartTLS {
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			_ = c.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+	return c, nil
+}
+
+// build multipart/alternative, 包含 text/plain 与 text/html
+func (e *email) build(msg *Message) ([]byte, error) {
+	buffer := bytes.NewBufferString("")
+	w := multipart.NewWriter(buffer)
+
+	headers := [][2]string{
+		{"From", e.from},
+		{"To", strings.Join(e.to, ", ")},
+		{"Subject", mime.BEncoding.Encode("UTF-8", msg.Title)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", w.Boundary())},
+	}
+	for _, item := range headers {
+		buffer.WriteString(fmt.Sprintf("%s: %s\r\n", item[0], item[1]))
+	}
+	buffer.WriteString("\r\n")
+
+	text := msg.Title + "\n\n" + msg.Content
+	err := writeQuotedPrintablePart(w, "text/plain; charset=UTF-8", []byte(text))
+	if err != nil {
+		return nil, err
+	}
+
+	html := bytes.NewBufferString("")
+	err = emailHTML.Execute(html, msg)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = writeQuotedPrintablePart(w, "text/html; charset=UTF-8", html.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeQuotedPrintablePart(w *multipart.Writer, contentType string, data []byte) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	qp := quotedprintable.NewWriter(part)
+	_, err = qp.Write(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(qp.Close())
+}
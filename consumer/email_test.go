@@ -0,0 +1,176 @@
+package consumer
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpServer 本地的 SMTP 替身, 只支持不加密, 不认证的会话
+type smtpServer struct {
+	listener net.Listener
+	messages chan *smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, messages: make(chan *smtpMessage, 1)}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+	msg := new(smtpMessage)
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			msg.from = line
+			reply("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, line)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data := strings.Builder{}
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			msg.data = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.messages <- msg
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	server := newSMTPServer(t)
+	e, err := newEmail("127.0.0.1", server.port(), "", "", EmailTLSNone, "alert@example.com",
+		[]string{"a@example.com", "b@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Send(&Message{
+		Title:   "错误: 1/1",
+		Color:   "red",
+		Content: "[eth] errors 1\n已屏蔽 2 个分组",
+		Footer:  "已屏蔽 2 个分组",
+		Groups: []*Group{{
+			Values: []string{"eth"},
+			Count:  1,
+			Fields: []*Field{{Key: "message", Value: "boom"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-server.messages
+	if msg.from != "MAIL FROM:<alert@example.com>" {
+		t.Errorf("from = %q", msg.from)
+	}
+	if len(msg.to) != 2 || msg.to[1] != "RCPT TO:<b@example.com>" {
+		t.Errorf("to = %q", msg.to)
+	}
+	for _, want := range []string{
+		"To: a@example.com, b@example.com",
+		"Subject: =?UTF-8?b?",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Type: text/html; charset=UTF-8",
+		"boom",
+	} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg.data)
+		}
+	}
+}
+
+func TestEmailSendError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	e, err := newEmail("127.0.0.1", port, "", "", EmailTLSNone, "alert@example.com", []string{"a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.Send(&Message{Title: "t"}); err == nil {
+		t.Fatal("Send() to a closed port should fail")
+	}
+}
+
+func TestNewEmail(t *testing.T) {
+	tests := []struct {
+		tls     string
+		to      []string
+		wantErr bool
+	}{
+		{"", []string{"a@example.com"}, false},
+		{EmailTLS, []string{"a@example.com"}, false},
+		{"ssl", []string{"a@example.com"}, true},
+		{EmailTLSNone, nil, true},
+	}
+	for idx, tt := range tests {
+		t.Run(strconv.Itoa(idx), func(t *testing.T) {
+			e, err := newEmail("localhost", 25, "user@example.com", "", tt.tls, "", tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (e.from != "user@example.com" || len(e.tls) == 0) {
+				t.Fatalf("defaults not applied: %+v", e)
+			}
+		})
+	}
+}
@@ -16,35 +16,47 @@ import (
 )
 
 type lark struct {
-	url    string
-	secret string
+	url     string
+	secret  string
+	userIDs []string // at someones, open id 或 user id
 }
 
-func newLark(url, secret string) *lark {
+func newLark(url, secret string, userIDs []string) *lark {
 	return &lark{
-		url:    url,
-		secret: secret,
+		url:     url,
+		secret:  secret,
+		userIDs: userIDs,
 	}
 }
 
-func (l *lark) Send(title, color, content string) error {
-	// fmt.Println(title)
-	// fmt.Println(content)
-	// return nil
+func (l *lark) Send(msg *Message) (string, error) {
 	temp := &cardBody{
 		MsgType: "interactive",
 	}
 	temp.Card.Config.WideScreenMode = true
 
 	temp.Card.Header.Title.Tag = "plain_text"
-	temp.Card.Header.Title.Content = title
-	temp.Card.Header.Template = color
+	temp.Card.Header.Title.Content = msg.Title
+	temp.Card.Header.Template = msg.Color
 
 	item := cardElement{Tag: "div"}
 	item.Text.Tag = "plain_text"
-	item.Text.Content = content
+	item.Text.Content = msg.Content
 	temp.Card.Elements = []cardElement{item}
 
+	if msg.Notify {
+		at := ""
+		for _, id := range append(append([]string{}, l.userIDs...), msg.LarkUserIDs...) {
+			at += fmt.Sprintf("<at id=%s></at>", id)
+		}
+		if len(at) > 0 {
+			item := cardElement{Tag: "div"}
+			item.Text.Tag = "lark_md"
+			item.Text.Content = at
+			temp.Card.Elements = append(temp.Card.Elements, item)
+		}
+	}
+
 	if len(l.secret) > 0 {
 		timestamp := time.Now().Unix()
 		temp.Timestamp = strconv.Itoa(int(timestamp))
@@ -54,7 +66,7 @@ func (l *lark) Send(title, color, content string) error {
 		h := hmac.New(sha256.New, []byte(stringToSign))
 		_, err := h.Write(data)
 		if err != nil {
-			return errors.WithStack(err)
+			return "", errors.WithStack(err)
 		}
 
 		signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
@@ -65,19 +77,33 @@ func (l *lark) Send(title, color, content string) error {
 
 	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewBuffer(bs))
 	if err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 	defer resp.Body.Close()
 
 	result, _ := io.ReadAll(resp.Body)
-	fmt.Println(string(result))
-	return nil
+	r := new(struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	})
+	err = json.Unmarshal(result, r)
+	if err != nil {
+		return "", errors.Wrapf(err, "lark response %s: %s", resp.Status, result)
+	}
+	// 11232: 发送频率超过限制
+	if r.Code == 11232 || resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(retryAfter(resp), "lark response %d: %s", r.Code, r.Msg)
+	}
+	if r.Code != 0 {
+		return "", errors.Errorf("lark response %d: %s", r.Code, r.Msg)
+	}
+	return string(result), nil
 }
 
 type cardBody struct {
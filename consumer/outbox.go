@@ -0,0 +1,207 @@
+package consumer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// 单次发送的超时
+	sendTimeout = 10 * time.Second
+
+	defaultMaxAttempts = 10
+	defaultMaxBackoff  = 30 * time.Minute
+	// 第一次重试的间隔, 之后每次翻倍
+	retryBackoff = 30 * time.Second
+)
+
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// Pending 等待发送的通知
+// 发送前写入, 发送成功后删除, 失败时等待重试
+// 由调用方通过 SetPersist/Restore 持久化, 重启后继续发送
+type Pending struct {
+	Target   string    `json:"target"`
+	Message  *Message  `json:"message"`
+	Attempts int       `json:"attempts"` // 为 0 时表示发送前进程退出
+	Created  time.Time `json:"created"`
+	Next     time.Time `json:"next"` // 下一次重试的时间
+	Error    string    `json:"error,omitempty"`
+	Done     []int     `json:"done,omitempty"` // partSender 已经发送的部分, 重试时跳过
+}
+
+// fail 指数退避, 厂商限流时至少等到限流结束
+func (p *Pending) fail(err error, now time.Time, maxBackoff time.Duration) {
+	p.Error = err.Error()
+	backoff := maxBackoff
+	if p.Attempts < 32 && retryBackoff<<(p.Attempts-1) < maxBackoff {
+		backoff = retryBackoff << (p.Attempts - 1)
+	}
+	e := new(throttledError)
+	if errors.As(err, &e) && e.retryAfter > backoff {
+		backoff = e.retryAfter
+	}
+	p.Next = now.Add(backoff)
+}
+
+// SetRetry maxAttempts 为 1 时不重试, 为 0 时使用默认值
+func (c *Consumer) SetRetry(maxAttempts int, maxBackoff time.Duration) {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	c.maxAttempts, c.maxBackoff = maxAttempts, maxBackoff
+}
+
+// SetPersist fn 在 pending 变化时调用, 例如发送前写入磁盘
+func (c *Consumer) SetPersist(fn func()) {
+	c.persist = fn
+}
+
+func (c *Consumer) save() {
+	if c.persist != nil {
+		c.persist()
+	}
+}
+
+// enqueue 发送前加入 pending, 不重试时返回 nil
+func (c *Consumer) enqueue(name string, msg *Message, now time.Time) *Pending {
+	if c.maxAttempts <= 1 {
+		return nil
+	}
+	item := &Pending{
+		Target:  name,
+		Message: msg,
+		Created: now,
+	}
+	c.pending = append(c.pending, item)
+	return item
+}
+
+// settle 根据第一次发送的结果, 删除或者等待重试
+// 超出限流的通知, 数量在之后的通知中汇总, 不再发送
+func (c *Consumer) settle(item *Pending, result *Result, now time.Time) {
+	if item == nil {
+		return
+	}
+	if result.Outcome == OutcomeSuppressed && c.targets[item.Target].textless() {
+		// 在之后的 Flush 中重新发送
+		result.Queued = true
+		return
+	}
+	if result.Err == nil {
+		c.remove(item)
+		return
+	}
+	result.Queued = true
+	if len(result.parts) > 0 {
+		// 重试时按实际发送的内容拆分, 已发送部分的序号才能对应
+		item.Message, item.Done = result.message, result.parts
+	}
+	item.Attempts = 1
+	item.fail(result.Err, now, c.maxBackoff)
+}
+
+func (c *Consumer) remove(item *Pending) {
+	for idx, other := range c.pending {
+		if other == item {
+			c.pending = append(c.pending[:idx], c.pending[idx+1:]...)
+			return
+		}
+	}
+}
+
+// resolved target 的恢复消息已发送, 不再重试这些分组的报警
+// 否则 pagerduty, alertmanager 中已经恢复的 incident 会被重新打开
+func (c *Consumer) resolved(name string, msg *Message) {
+	if msg.Kind != KindRecover || len(msg.Resolved) == 0 {
+		return
+	}
+	tags := make(map[string]bool, len(msg.Resolved))
+	for _, group := range msg.Resolved {
+		tags[group.Tag] = true
+	}
+	pending := make([]*Pending, 0, len(c.pending))
+	for _, item := range c.pending {
+		if item.Target != name || item.Message.Kind != KindAlert {
+			pending = append(pending, item)
+			continue
+		}
+		groups := make([]*Group, 0, len(item.Message.Groups))
+		for _, group := range item.Message.Groups {
+			if !tags[group.Tag] {
+				groups = append(groups, group)
+			}
+		}
+		if len(groups) == len(item.Message.Groups) {
+			pending = append(pending, item)
+			continue
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		// Content 中仍然包含已恢复的分组, 只影响按分组发送的 target
+		temp := *item.Message
+		temp.Groups = groups
+		item.Message = &temp
+		pending = append(pending, item)
+	}
+	c.pending = pending
+}
+
+// retry 重新发送到期的通知, 超过重试次数后丢弃
+func (c *Consumer) retry(now time.Time) Results {
+	results := make(Results, 0)
+	if len(c.pending) == 0 {
+		return results
+	}
+	defer c.save()
+
+	for _, item := range append([]*Pending{}, c.pending...) {
+		l, ok := c.targets[item.Target]
+		if !ok {
+			// 配置已修改, 丢弃
+			c.remove(item)
+			continue
+		}
+		if now.Before(item.Next) {
+			continue
+		}
+		result := l.resend(item.Message, item.Done)
+		result.Target = item.Target
+		result.Retry = true
+		if result.Outcome == OutcomeSuppressed {
+			// 没有令牌, 不算作一次失败, 下一次 Flush 时再发送
+			continue
+		}
+		results = append(results, result)
+		if result.Err == nil {
+			c.remove(item)
+			c.resolved(item.Target, item.Message)
+			continue
+		}
+		item.Done = result.parts
+		item.Attempts++
+		if item.Attempts >= c.maxAttempts {
+			result.Err = errors.WithMessagef(result.Err, "give up after %d attempts", item.Attempts)
+			c.remove(item)
+			continue
+		}
+		item.fail(result.Err, now, c.maxBackoff)
+	}
+	return results
+}
+
+// Pending 等待发送的通知
+func (c *Consumer) Pending() []*Pending {
+	return c.pending
+}
+
+// Restore 恢复重启前等待发送的通知
+func (c *Consumer) Restore(list []*Pending) {
+	c.pending = append(c.pending, list...)
+}
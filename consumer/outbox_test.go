@@ -0,0 +1,187 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPendingFail(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	plain := errors.New("boom")
+	tests := []struct {
+		name       string
+		attempts   int
+		err        error
+		maxBackoff time.Duration
+		want       time.Duration
+	}{
+		{"first", 1, plain, time.Hour, 30 * time.Second},
+		{"second", 2, plain, time.Hour, time.Minute},
+		{"fourth", 4, plain, time.Hour, 4 * time.Minute},
+		{"capped", 4, plain, 3 * time.Minute, 3 * time.Minute},
+		{"overflow", 64, plain, time.Hour, time.Hour},
+		{"throttled", 1, newThrottledError(10*time.Minute, "slow down"), time.Hour, 10 * time.Minute},
+		{"throttled shorter", 4, newThrottledError(time.Second, "slow down"), time.Hour, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pending{Attempts: tt.attempts}
+			p.fail(tt.err, now, tt.maxBackoff)
+			if got := p.Next.Sub(now); got != tt.want {
+				t.Fatalf("backoff = %s, want %s", got, tt.want)
+			}
+			if p.Error != tt.err.Error() {
+				t.Fatalf("error = %q, want %q", p.Error, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	target := &fakeTarget{err: errors.New("boom")}
+	c := new(Consumer)
+	c.SetRetry(3, 0)
+	c.add("pagerduty", target)
+	saved := make([]int, 0)
+	c.SetPersist(func() {
+		saved = append(saved, len(c.Pending()))
+	})
+
+	if !c.SendMessage(&Message{Kind: KindAlert, Groups: []*Group{{Tag: "a"}, {Tag: "b"}}}).Handled() {
+		t.Fatal("failed message should be queued")
+	}
+	// 发送前已经写入
+	if len(saved) != 2 || saved[0] != 1 || saved[1] != 1 {
+		t.Fatalf("saved = %v, want [1 1]", saved)
+	}
+	item := c.Pending()[0]
+	if item.Attempts != 1 || item.Next.IsZero() {
+		t.Fatalf("pending = %+v, want one failed attempt", item)
+	}
+
+	// 恢复消息发送成功后, 不再重试已恢复分组的报警
+	target.err = nil
+	c.SendMessage(&Message{Kind: KindRecover, Resolved: []*Group{{Tag: "a"}}})
+	if len(c.Pending()) != 1 || len(c.Pending()[0].Message.Groups) != 1 || c.Pending()[0].Message.Groups[0].Tag != "b" {
+		t.Fatalf("pending groups should be [b], got %+v", c.Pending())
+	}
+
+	// 到期后重试成功
+	results := c.retry(time.Now().Add(time.Hour))
+	if len(results) != 1 || results[0].Err != nil || !results[0].Retry {
+		t.Fatalf("retry results = %+v", results)
+	}
+	if len(c.Pending()) != 0 {
+		t.Fatalf("pending = %+v, want empty", c.Pending())
+	}
+}
+
+func TestOutboxGiveUp(t *testing.T) {
+	c := new(Consumer)
+	c.SetRetry(2, 0)
+	c.add("ding", &fakeTarget{err: errors.New("boom")})
+
+	c.SendMessage(&Message{Kind: KindAlert})
+	results := c.retry(time.Now().Add(time.Hour))
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("retry results = %+v, want one failure", results)
+	}
+	if len(c.Pending()) != 0 {
+		t.Fatalf("pending = %+v, want dropped after max attempts", c.Pending())
+	}
+}
+
+func TestOutboxDisabled(t *testing.T) {
+	c := new(Consumer)
+	c.SetRetry(1, 0)
+	c.add("ding", &fakeTarget{err: errors.New("boom")})
+
+	results := c.SendMessage(&Message{Kind: KindAlert})
+	if results.Handled() || len(c.Pending()) != 0 {
+		t.Fatalf("results = %+v, pending = %+v, want neither sent nor queued", results, c.Pending())
+	}
+}
+
+func TestOutboxRateLimited(t *testing.T) {
+	c := new(Consumer)
+	c.SetRateLimit(1, 1)
+	c.SetRetry(3, 0)
+	target := &fakeTarget{err: errors.New("boom")}
+	c.add("ding", target)
+
+	c.SendMessage(&Message{Kind: KindAlert})
+	target.err = nil
+	// 没有令牌时保留, 也不计入失败次数
+	if results := c.retry(time.Now().Add(time.Hour)); len(results) != 0 {
+		t.Fatalf("retry results = %+v, want none while rate limited", results)
+	}
+	if len(c.Pending()) != 1 || c.Pending()[0].Attempts != 1 {
+		t.Fatalf("pending = %+v, want kept with one attempt", c.Pending())
+	}
+}
+
+func TestOutboxTextlessSuppressed(t *testing.T) {
+	c := new(Consumer)
+	c.SetRateLimit(1, 1)
+	c.SetRetry(3, 0)
+	c.add("pagerduty", new(fakeTextless))
+
+	c.SendMessage(&Message{Kind: KindAlert})
+	results := c.SendMessage(&Message{Kind: KindAlert})
+	if results[0].Outcome != OutcomeSuppressed {
+		t.Fatalf("outcome = %s, want %s", results[0].Outcome, OutcomeSuppressed)
+	}
+	if len(c.Pending()) != 1 {
+		t.Fatalf("pending = %+v, want the suppressed alert kept", c.Pending())
+	}
+}
+
+func TestOutboxTelegramPartial(t *testing.T) {
+	failed := map[string]bool{"b": true}
+	sent := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(struct {
+			ChatID string `json:"chat_id"`
+		})
+		_ = json.NewDecoder(r.Body).Decode(body)
+		if failed[body.ChatID] {
+			_, _ = w.Write([]byte(`{"ok":false,"description":"boom"}`))
+			return
+		}
+		sent = append(sent, body.ChatID)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	target, err := newTelegram("token", []string{"a", "b", "c"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.url = server.URL
+	c := new(Consumer)
+	c.SetRetry(3, 0)
+	c.add("telegram", target)
+
+	results := c.SendMessage(&Message{Kind: KindAlert, Title: "t", Content: "c"})
+	if results.Err() == nil || len(c.Pending()) != 1 {
+		t.Fatalf("results = %+v, pending = %+v, want chat b queued", results, c.Pending())
+	}
+	if done := c.Pending()[0].Done; len(done) != 2 {
+		t.Fatalf("done = %v, want chats a and c", done)
+	}
+
+	// 重试时只发送之前失败的 chat
+	failed["b"] = false
+	results = c.retry(time.Now().Add(time.Hour))
+	if results.Err() != nil || len(c.Pending()) != 0 {
+		t.Fatalf("retry results = %+v, pending = %+v", results, c.Pending())
+	}
+	if strings.Join(sent, ",") != "a,c,b" {
+		t.Fatalf("sent = %v, want [a c b]", sent)
+	}
+}
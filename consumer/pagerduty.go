@@ -0,0 +1,162 @@
+package consumer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+const (
+	pagerDutyURL          = "https://events.pagerduty.com/v2/enqueue"
+	pagerDutySummaryLimit = 1024
+	pagerDutyDedupLimit   = 255
+)
+
+// pagerDuty 每个分组对应一个 incident
+// 报警时 trigger, 恢复时 resolve, 启动/心跳消息忽略
+type pagerDuty struct {
+	routingKey string
+	severity   string
+}
+
+func newPagerDuty(routingKey, severity string) *pagerDuty {
+	if len(severity) == 0 {
+		severity = "error"
+	}
+	return &pagerDuty{
+		routingKey: routingKey,
+		severity:   severity,
+	}
+}
+
+func (*pagerDuty) textless() {}
+
+func (p *pagerDuty) Send(msg *Message) (string, error) {
+	var (
+		action string
+		groups []*Group
+	)
+	switch msg.Kind {
+	case KindAlert:
+		action, groups = "trigger", msg.Groups
+	case KindRecover:
+		action, groups = "resolve", msg.Resolved
+	default:
+		return "", nil
+	}
+
+	var (
+		response string
+		result   error
+	)
+	for _, item := range groups {
+		temp, err := p.send(p.newEvent(action, msg, item))
+		if err != nil && result == nil {
+			result = err
+		}
+		if len(temp) > 0 {
+			response = temp
+		}
+	}
+	return response, result
+}
+
+func (p *pagerDuty) newEvent(action string, msg *Message, group *Group) *pagerDutyEvent {
+	event := &pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: action,
+		DedupKey:    dedupKey(msg.Job, group.Tag),
+	}
+	if action != "trigger" {
+		return event
+	}
+
+	source := msg.Job
+	if len(source) == 0 {
+		source = "funnel-log-reporter"
+	}
+	details := map[string]interface{}{
+		"count": group.Count,
+	}
+	// summary 中附带第一个 show_keys 的值
+	summary := fmt.Sprintf("%v errors %d", group.Values, group.Count)
+	for _, item := range group.Fields {
+		if item.Missing {
+			continue
+		}
+		value := strings.TrimSpace(item.Value)
+		if len(details) == 1 {
+			summary += ": " + value
+		}
+		details[item.Key] = value
+	}
+	event.Payload = &pagerDutyPayload{
+		Summary:       limitText(summary, pagerDutySummaryLimit),
+		Source:        source,
+		Severity:      p.severity,
+		Timestamp:     time.UnixMilli(group.LastTime).Format(time.RFC3339),
+		Group:         msg.Job,
+		CustomDetails: details,
+	}
+	return event
+}
+
+// dedupKey 同一个 job 下的同一个分组, 对应同一个 incident
+func dedupKey(job, groupTag string) string {
+	key := job + "/" + groupTag
+	if len(key) <= pagerDutyDedupLimit {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *pagerDuty) send(event *pagerDutyEvent) (string, error) {
+	bs, _ := json.Marshal(event)
+
+	req, err := http.NewRequest(http.MethodPost, pagerDutyURL, bytes.NewBuffer(bs))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(retryAfter(resp), "pagerduty response %s: %s", resp.Status, result)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return "", errors.Errorf("pagerduty response %s: %s", resp.Status, result)
+	}
+	return string(result), nil
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
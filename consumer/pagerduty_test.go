@@ -0,0 +1,55 @@
+package consumer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupKey(t *testing.T) {
+	if key := dedupKey("job", "eth/node"); key != "job/eth/node" {
+		t.Fatalf("dedupKey = %s", key)
+	}
+	long := strings.Repeat("x", pagerDutyDedupLimit)
+	key := dedupKey("job", long)
+	if len(key) > pagerDutyDedupLimit || key != dedupKey("job", long) {
+		t.Fatalf("dedupKey = %s, want a stable hash", key)
+	}
+	if key == dedupKey("other", long) {
+		t.Fatal("different jobs should not share the dedup key")
+	}
+}
+
+func TestPagerDutyEvent(t *testing.T) {
+	p := newPagerDuty("key", "")
+	group := &Group{
+		Tag:    "eth/node",
+		Values: []string{"eth", "node"},
+		Count:  3,
+		Fields: []*Field{{Key: "host", Missing: true}, {Key: "message", Value: " boom "}},
+	}
+	msg := &Message{Job: "test", Kind: KindAlert, Groups: []*Group{group}}
+
+	trigger := p.newEvent("trigger", msg, group)
+	if trigger.EventAction != "trigger" || trigger.DedupKey != "test/eth/node" || trigger.Payload == nil {
+		t.Fatalf("trigger = %+v", trigger)
+	}
+	if trigger.Payload.Severity != "error" || trigger.Payload.Summary != "[eth node] errors 3: boom" {
+		t.Fatalf("payload = %+v", trigger.Payload)
+	}
+	if _, ok := trigger.Payload.CustomDetails["host"]; ok {
+		t.Fatalf("missing field should not be a detail: %v", trigger.Payload.CustomDetails)
+	}
+
+	// resolve 与 trigger 使用同一个 dedup key, 关闭对应的 incident
+	resolve := p.newEvent("resolve", &Message{Job: "test", Kind: KindRecover, Resolved: []*Group{group}}, group)
+	if resolve.EventAction != "resolve" || resolve.DedupKey != trigger.DedupKey || resolve.Payload != nil {
+		t.Fatalf("resolve = %+v", resolve)
+	}
+}
+
+func TestPagerDutyIgnoreInfo(t *testing.T) {
+	response, err := newPagerDuty("key", "").Send(&Message{Kind: KindInfo, Title: "start"})
+	if err != nil || len(response) > 0 {
+		t.Fatalf("info message should be ignored: %s, %v", response, err)
+	}
+}
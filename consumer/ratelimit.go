@@ -0,0 +1,248 @@
+package consumer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 厂商没有给出等待时间时, 暂停发送的时长
+const defaultThrottlePause = time.Minute
+
+// throttledError 厂商返回的限流错误, 在 retryAfter 之后才能继续发送
+type throttledError struct {
+	retryAfter time.Duration
+	err        error
+}
+
+func newThrottledError(retryAfter time.Duration, format string, args ...interface{}) error {
+	if retryAfter <= 0 {
+		retryAfter = defaultThrottlePause
+	}
+	return &throttledError{
+		retryAfter: retryAfter,
+		err:        errors.Errorf(format, args...),
+	}
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("throttled, retry after %s: %s", e.retryAfter, e.err)
+}
+
+func (e *throttledError) Unwrap() error {
+	return e.err
+}
+
+// retryAfter 解析 Retry-After header, 只支持秒数
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// partSender 一条通知需要多次请求的 target, 例如 telegram 的多个 chat, 超长消息的多个分段
+// done 为已经发送的部分, 返回本次发送的部分, 重试时跳过已发送的部分, 避免重复
+type partSender interface {
+	sendParts(msg *Message, done map[int]bool) (response string, sent []int, err error)
+}
+
+// textless 不展示通知文本的 target, 例如 pagerduty, alertmanager
+// 限流的汇总无法附加在通知中, 被限流的通知由 Consumer 保留在 pending 中, 之后重新发送
+type textless interface {
+	textless()
+}
+
+// limiter 每个 target 单独的令牌桶
+// 超出令牌桶的通知不会重发, 数量在下一条发出的通知中, 或者 Flush 时汇总提示, textless target 除外
+// 厂商限流的通知返回错误, 由 Consumer 在限流结束后重试
+type limiter struct {
+	target target
+
+	mu     sync.Mutex
+	rate   float64 // 每秒的令牌数, 为 0 时不限流
+	burst  float64
+	tokens float64
+	last   time.Time
+	// 厂商限流时, 在此之前不再发送
+	pausedUntil time.Time
+	suppressed  map[string]int // key 为 Message.Kind
+}
+
+func newLimiter(t target) *limiter {
+	return &limiter{
+		target:     t,
+		suppressed: make(map[string]int),
+	}
+}
+
+func (l *limiter) setRate(perMinute float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = perMinute / 60
+	l.burst = float64(burst)
+	if l.burst <= 0 {
+		l.burst = perMinute
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = l.burst
+	l.last = time.Now()
+}
+
+// allow 取出一个令牌
+func (l *limiter) allow(now time.Time) bool {
+	if now.Before(l.pausedUntil) {
+		return false
+	}
+	if l.rate <= 0 {
+		return true
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (l *limiter) send(msg *Message) *Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if !l.allow(now) {
+		if !l.textless() {
+			l.suppressed[msg.Kind]++
+		}
+		return &Result{Outcome: OutcomeSuppressed}
+	}
+
+	summary := l.summary()
+	if len(summary) > 0 {
+		temp := *msg
+		temp.Content = joinText(msg.Content, summary)
+		temp.Footer = joinText(msg.Footer, summary)
+		msg = &temp
+	}
+	result := l.do(msg, nil, now)
+	if result.Err == nil && len(summary) > 0 {
+		l.suppressed = make(map[string]int)
+	}
+	return result
+}
+
+// resend 重试发送失败的通知, 没有令牌时返回 OutcomeSuppressed, 但不计入汇总, 由调用方继续等待重试
+// done 为之前已经发送的部分, 见 partSender
+func (l *limiter) resend(msg *Message, done []int) *Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if !l.allow(now) {
+		return &Result{Outcome: OutcomeSuppressed}
+	}
+	return l.do(msg, done, now)
+}
+
+// flush 有被限流的通知, 且之后没有新的通知时, 单独发送一条汇总
+// 没有发送时返回 nil
+func (l *limiter) flush() *Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	summary := l.summary()
+	if len(summary) == 0 {
+		return nil
+	}
+	now := time.Now()
+	if !l.allow(now) {
+		return nil
+	}
+	result := l.do(&Message{
+		Kind:    KindInfo,
+		Title:   "通知已限流",
+		Content: summary,
+	}, nil, now)
+	if result.Err == nil {
+		l.suppressed = make(map[string]int)
+	}
+	return result
+}
+
+func (l *limiter) do(msg *Message, done []int, now time.Time) *Result {
+	var response string
+	var err error
+	parts := done
+	if t, ok := l.target.(partSender); ok {
+		set := make(map[int]bool, len(done))
+		for _, idx := range done {
+			set[idx] = true
+		}
+		var sent []int
+		response, sent, err = t.sendParts(msg, set)
+		parts = append(append([]int{}, done...), sent...)
+	} else {
+		response, err = l.target.Send(msg)
+	}
+	result := &Result{
+		Outcome:  OutcomeSent,
+		Latency:  time.Since(now),
+		Response: limitText(response, maxResponseLength),
+		Err:      err,
+		message:  msg,
+		parts:    parts,
+	}
+	if err != nil {
+		result.Outcome = OutcomeFailed
+	}
+	l.handle(err, now)
+	return result
+}
+
+func (l *limiter) textless() bool {
+	_, ok := l.target.(textless)
+	return ok
+}
+
+// handle 厂商限流时暂停发送
+func (l *limiter) handle(err error, now time.Time) {
+	e := new(throttledError)
+	if errors.As(err, &e) {
+		l.pausedUntil = now.Add(e.retryAfter)
+	}
+}
+
+func isThrottled(err error) bool {
+	e := new(throttledError)
+	return errors.As(err, &e)
+}
+
+func (l *limiter) summary() string {
+	total := 0
+	for _, count := range l.suppressed {
+		total += count
+	}
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d 条通知因频率限制未发送(报警 %d, 恢复 %d, 其他 %d)", total,
+		l.suppressed[KindAlert], l.suppressed[KindRecover], l.suppressed[KindInfo])
+}
+
+func joinText(text, line string) string {
+	if len(text) == 0 {
+		return line
+	}
+	return text + "\n" + line
+}
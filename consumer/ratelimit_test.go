@@ -0,0 +1,126 @@
+package consumer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTarget 记录收到的通知, err 不为空时发送失败
+type fakeTarget struct {
+	sent []*Message
+	err  error
+}
+
+func (f *fakeTarget) Send(msg *Message) (string, error) {
+	f.sent = append(f.sent, msg)
+	return "ok", f.err
+}
+
+type fakeTextless struct {
+	fakeTarget
+}
+
+func (*fakeTextless) textless() {}
+
+func TestLimiterSuppressAndSummary(t *testing.T) {
+	target := new(fakeTarget)
+	l := newLimiter(target)
+	l.setRate(1, 2)
+
+	outcomes := make([]string, 0)
+	for _, kind := range []string{KindAlert, KindAlert, KindAlert, KindRecover} {
+		outcomes = append(outcomes, l.send(&Message{Kind: kind, Content: "c"}).Outcome)
+	}
+	want := []string{OutcomeSent, OutcomeSent, OutcomeSuppressed, OutcomeSuppressed}
+	if strings.Join(outcomes, ",") != strings.Join(want, ",") {
+		t.Fatalf("outcomes = %v, want %v", outcomes, want)
+	}
+
+	// 补充令牌后, 汇总附加在下一条通知中
+	l.tokens = 1
+	result := l.send(&Message{Kind: KindInfo, Content: "c"})
+	if result.Outcome != OutcomeSent {
+		t.Fatalf("outcome = %s, want %s", result.Outcome, OutcomeSent)
+	}
+	last := target.sent[len(target.sent)-1]
+	summary := "2 条通知因频率限制未发送(报警 1, 恢复 1, 其他 0)"
+	if !strings.Contains(last.Content, summary) || !strings.Contains(last.Footer, summary) {
+		t.Fatalf("summary not in content %q or footer %q", last.Content, last.Footer)
+	}
+	if len(l.suppressed) != 0 {
+		t.Fatalf("suppressed = %v, want empty after summary is sent", l.suppressed)
+	}
+	if l.flush() != nil {
+		t.Fatal("flush() should not send without suppressed notifications")
+	}
+}
+
+func TestLimiterFlush(t *testing.T) {
+	target := new(fakeTarget)
+	l := newLimiter(target)
+	l.setRate(1, 1)
+	l.send(&Message{Kind: KindAlert})
+	l.send(&Message{Kind: KindAlert})
+
+	if l.flush() != nil {
+		t.Fatal("flush() should wait for a token")
+	}
+	l.tokens = 1
+	result := l.flush()
+	if result == nil || result.Outcome != OutcomeSent {
+		t.Fatalf("flush() = %+v, want sent", result)
+	}
+	if last := target.sent[len(target.sent)-1]; last.Title != "通知已限流" {
+		t.Fatalf("flush title = %q", last.Title)
+	}
+}
+
+func TestLimiterTextless(t *testing.T) {
+	l := newLimiter(new(fakeTextless))
+	l.setRate(1, 1)
+	l.send(&Message{Kind: KindAlert})
+	if result := l.send(&Message{Kind: KindAlert}); result.Outcome != OutcomeSuppressed {
+		t.Fatalf("outcome = %s, want %s", result.Outcome, OutcomeSuppressed)
+	}
+	if len(l.suppressed) != 0 {
+		t.Fatalf("suppressed = %v, textless targets should not count", l.suppressed)
+	}
+}
+
+func TestLimiterResendNotCounted(t *testing.T) {
+	l := newLimiter(new(fakeTarget))
+	l.setRate(1, 1)
+	l.send(&Message{Kind: KindAlert})
+	if result := l.resend(&Message{Kind: KindAlert}, nil); result.Outcome != OutcomeSuppressed {
+		t.Fatalf("outcome = %s, want %s", result.Outcome, OutcomeSuppressed)
+	}
+	if len(l.suppressed) != 0 {
+		t.Fatalf("suppressed = %v, resend should not count", l.suppressed)
+	}
+}
+
+func TestLimiterThrottled(t *testing.T) {
+	target := &fakeTarget{err: newThrottledError(time.Hour, "too many requests")}
+	l := newLimiter(target)
+	l.setRate(0, 0)
+
+	if result := l.send(&Message{}); result.Outcome != OutcomeFailed {
+		t.Fatalf("outcome = %s, want %s", result.Outcome, OutcomeFailed)
+	}
+	target.err = nil
+	if result := l.send(&Message{}); result.Outcome != OutcomeSuppressed {
+		t.Fatalf("outcome = %s, want %s while paused", result.Outcome, OutcomeSuppressed)
+	}
+	if len(target.sent) != 1 {
+		t.Fatalf("sent %d, want 1", len(target.sent))
+	}
+
+	plain := &fakeTarget{err: errors.New("boom")}
+	l = newLimiter(plain)
+	l.send(&Message{})
+	if !l.pausedUntil.IsZero() {
+		t.Fatal("other errors should not pause the limiter")
+	}
+}
@@ -0,0 +1,64 @@
+package consumer
+
+import (
+	"time"
+)
+
+const (
+	OutcomeSent       = "sent"
+	OutcomeSuppressed = "suppressed" // 超出限流, 数量在之后的通知中汇总, textless target 之后重新发送
+	OutcomeFailed     = "failed"     // 发送失败, 等待重试
+
+	// fallback target 名称的前缀
+	FallbackPrefix = "fallback."
+
+	maxResponseLength = 512
+)
+
+// Result 一个 target 的发送结果
+type Result struct {
+	Channel  string // 由调用方设置
+	Target   string
+	Outcome  string
+	Latency  time.Duration
+	Response string // 厂商的响应内容
+	Err      error
+	Retry    bool // 是否为失败后的重试
+	Queued   bool // 没有发送成功, 已写入 outbox 等待重试
+
+	// 实际发送的通知, 以及 partSender 已经发送的部分
+	message *Message
+	parts   []int
+}
+
+type Results []*Result
+
+// Err 返回第一个错误
+func (r Results) Err() error {
+	for _, item := range r {
+		if item.Err != nil {
+			return item.Err
+		}
+	}
+	return nil
+}
+
+// Handled 至少一个 target 已发送, 或者已写入 outbox 等待重试
+func (r Results) Handled() bool {
+	for _, item := range r {
+		if item.Outcome == OutcomeSent || item.Queued {
+			return true
+		}
+	}
+	return false
+}
+
+// failed 所有 target 都发送失败
+func (r Results) failed() bool {
+	for _, item := range r {
+		if item.Outcome != OutcomeFailed {
+			return false
+		}
+	}
+	return len(r) > 0
+}
@@ -0,0 +1,161 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// slackTextLimit section 中 text 的最大长度
+// https://api.slack.com/reference/block-kit/blocks#section
+const (
+	slackTextLimit  = 3000
+	slackBlockLimit = 50
+)
+
+// colors 将 lark 的 template 颜色映射为 rgb
+var colors = map[string]string{
+	"blue":      "#3370ff",
+	"wathet":    "#7dbcf5",
+	"turquoise": "#2dbeab",
+	"green":     "#34c724",
+	"yellow":    "#ffc60a",
+	"orange":    "#ff8800",
+	"red":       "#f54a45",
+	"carmine":   "#d83b6c",
+	"violet":    "#b44ad8",
+	"purple":    "#7f3bf5",
+	"indigo":    "#4954e6",
+	"grey":      "#8f959e",
+}
+
+func rgbColor(color string) string {
+	if strings.HasPrefix(color, "#") {
+		return color
+	}
+	if rgb, ok := colors[color]; ok {
+		return rgb
+	}
+	return colors["grey"]
+}
+
+type slack struct {
+	url    string
+	users  []string // user id, 如 U024BE7LH
+	groups []string // user group id, 如 SAZ94GDB8
+}
+
+func newSlack(url string, users, groups []string) *slack {
+	return &slack{
+		url:    url,
+		users:  users,
+		groups: groups,
+	}
+}
+
+func (s *slack) Send(msg *Message) (string, error) {
+	temp := &slackBody{
+		Text: msg.Title,
+		Blocks: []*slackBlock{{
+			Type: "header",
+			Text: &slackText{Type: "plain_text", Text: limitText(msg.Title, 150)},
+		}},
+	}
+
+	if msg.Notify {
+		mentions := s.mentions(msg.SlackUsers, msg.SlackGroups)
+		if len(mentions) > 0 {
+			temp.Blocks = append(temp.Blocks, newSlackSection(mentions))
+		}
+	}
+
+	attachment := &slackAttachment{Color: rgbColor(msg.Color)}
+	if len(msg.Groups) == 0 {
+		attachment.Blocks = append(attachment.Blocks, newSlackSection("```"+msg.Content+"```"))
+	}
+	// 没有分组时, Footer 已包含在 Content 中
+	footer := len(msg.Groups) > 0 && len(msg.Footer) > 0
+	limit := slackBlockLimit
+	if footer {
+		limit--
+	}
+	for idx, item := range msg.Groups {
+		if idx == limit-1 && len(msg.Groups) > limit {
+			attachment.Blocks = append(attachment.Blocks,
+				newSlackSection(fmt.Sprintf("... and %d more groups", len(msg.Groups)-idx)))
+			break
+		}
+		attachment.Blocks = append(attachment.Blocks, newSlackSection("```"+item.String()+"```"))
+	}
+	if footer {
+		attachment.Blocks = append(attachment.Blocks, newSlackSection(msg.Footer))
+	}
+	temp.Attachments = []*slackAttachment{attachment}
+
+	bs, _ := json.Marshal(temp)
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewBuffer(bs))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(retryAfter(resp), "slack response %s: %s", resp.Status, result)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("slack response %s: %s", resp.Status, result)
+	}
+	return string(result), nil
+}
+
+func (s *slack) mentions(users, groups []string) string {
+	list := make([]string, 0, len(s.users)+len(users)+len(s.groups)+len(groups))
+	for _, item := range append(append([]string{}, s.users...), users...) {
+		list = append(list, fmt.Sprintf("<@%s>", item))
+	}
+	for _, item := range append(append([]string{}, s.groups...), groups...) {
+		list = append(list, fmt.Sprintf("<!subteam^%s>", item))
+	}
+	return strings.Join(list, " ")
+}
+
+func newSlackSection(text string) *slackBlock {
+	return &slackBlock{
+		Type: "section",
+		Text: &slackText{Type: "mrkdwn", Text: limitText(text, slackTextLimit)},
+	}
+}
+
+type slackBody struct {
+	Text        string             `json:"text"`
+	Blocks      []*slackBlock      `json:"blocks"`
+	Attachments []*slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string        `json:"color"`
+	Blocks []*slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// teamsStyles 将 lark 的 template 颜色映射为 adaptive card container style
+// https://adaptivecards.io/explorer/Container.html
+var teamsStyles = map[string]string{
+	"red":       "attention",
+	"carmine":   "attention",
+	"orange":    "warning",
+	"yellow":    "warning",
+	"green":     "good",
+	"turquoise": "good",
+	"blue":      "accent",
+	"wathet":    "accent",
+	"indigo":    "accent",
+	"violet":    "accent",
+	"purple":    "accent",
+	"grey":      "emphasis",
+}
+
+func teamsStyle(color string) string {
+	if style, ok := teamsStyles[color]; ok {
+		return style
+	}
+	return "default"
+}
+
+type teams struct {
+	url string
+}
+
+func newTeams(url string) *teams {
+	return &teams{
+		url: url,
+	}
+}
+
+func (t *teams) Send(msg *Message) (string, error) {
+	body := []interface{}{
+		map[string]interface{}{
+			"type":  "Container",
+			"style": teamsStyle(msg.Color),
+			"bleed": true,
+			"items": []interface{}{
+				newTeamsText(msg.Title, "Bolder", false),
+			},
+		},
+	}
+
+	if len(msg.Groups) == 0 {
+		text := newTeamsText(msg.Content, "", false)
+		text["fontType"] = "Monospace"
+		body = append(body, text)
+	}
+	for _, item := range msg.Groups {
+		body = append(body, newTeamsText(fmt.Sprintf("%v errors %d", item.Values, item.Count), "Bolder", true))
+
+		facts := make([]map[string]string, 0, len(item.Fields))
+		for _, field := range item.Fields {
+			value := "-"
+			if !field.Missing {
+				value = strings.TrimSpace(field.Value)
+			}
+			facts = append(facts, map[string]string{"title": field.Key, "value": value})
+		}
+		if len(facts) > 0 {
+			body = append(body, map[string]interface{}{
+				"type":  "FactSet",
+				"facts": facts,
+			})
+		}
+	}
+	// 没有分组时, Footer 已包含在 Content 中
+	if len(msg.Groups) > 0 && len(msg.Footer) > 0 {
+		body = append(body, newTeamsText(msg.Footer, "", true))
+	}
+
+	temp := map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"msteams": map[string]string{"width": "Full"},
+					"body":    body,
+				},
+			},
+		},
+	}
+
+	bs, _ := json.Marshal(temp)
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewBuffer(bs))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(retryAfter(resp), "teams response %s: %s", resp.Status, result)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", errors.Errorf("teams response %s: %s", resp.Status, result)
+	}
+	return string(result), nil
+}
+
+func newTeamsText(text, weight string, separator bool) map[string]interface{} {
+	item := map[string]interface{}{
+		"type": "TextBlock",
+		"text": text,
+		"wrap": true,
+	}
+	if len(weight) > 0 {
+		item["weight"] = weight
+	}
+	if separator {
+		item["separator"] = true
+	}
+	return item
+}
@@ -0,0 +1,161 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TelegramMarkdownV2 = "MarkdownV2"
+	TelegramHTML       = "HTML"
+
+	// telegramTextLimit 单条消息的最大字符数
+	telegramTextLimit = 4096
+	telegramAPI       = "https://api.telegram.org"
+)
+
+// telegramEscaper https://core.telegram.org/bots/api#markdownv2-style
+var telegramEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// telegramCodeEscaper pre 与 code 中只需要转义 ` 和 \
+var telegramCodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+type telegram struct {
+	url       string
+	chatIDs   []string
+	parseMode string
+}
+
+func newTelegram(token string, chatIDs []string, parseMode string) (*telegram, error) {
+	switch parseMode {
+	case "":
+		parseMode = TelegramHTML
+	case TelegramHTML, TelegramMarkdownV2:
+	default:
+		return nil, errors.Errorf("unknown telegram parse mode %s", parseMode)
+	}
+	return &telegram{
+		url:       fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, token),
+		chatIDs:   chatIDs,
+		parseMode: parseMode,
+	}, nil
+}
+
+func (t *telegram) Send(msg *Message) (string, error) {
+	response, _, err := t.sendParts(msg, nil)
+	return response, err
+}
+
+// sendParts 第 i 个 chat 的第 j 段消息, 序号为 i*len(texts)+j
+// 一个 chat 发送失败时, 继续发送其他 chat, 同一个 chat 中的分段按顺序发送
+func (t *telegram) sendParts(msg *Message, done map[int]bool) (string, []int, error) {
+	texts := t.render(msg)
+	var response string
+	var result error
+	sent := make([]int, 0)
+	for i, chatID := range t.chatIDs {
+		for j, text := range texts {
+			part := i*len(texts) + j
+			if done[part] {
+				continue
+			}
+			temp, err := t.send(chatID, text, msg.Notify)
+			if err != nil {
+				result = err
+				break
+			}
+			response = temp
+			sent = append(sent, part)
+		}
+		if isThrottled(result) {
+			break
+		}
+	}
+	return response, sent, result
+}
+
+// render 标题加粗, 内容放在代码块中
+// 超过长度限制时拆分为多条消息, 每条消息都带有标题与序号
+func (t *telegram) render(msg *Message) []string {
+	title, open, end := "", "", ""
+	escape := html.EscapeString
+	if t.parseMode == TelegramHTML {
+		title = "<b>" + html.EscapeString(msg.Title) + "</b>"
+		open, end = "<pre>", "</pre>"
+	} else {
+		title = "*" + telegramEscaper.Replace(msg.Title) + "*"
+		open, end = "```\n", "```"
+		escape = telegramCodeEscaper.Replace
+	}
+
+	// 预留序号 " (99/99)" 与换行的长度
+	limit := telegramTextLimit - utf8.RuneCountInString(title+open+end) - 16
+	chunks := splitText(msg.Content, limit, escape, utf8.RuneCountInString)
+	if len(chunks) == 1 {
+		return []string{title + "\n" + open + chunks[0] + end}
+	}
+
+	result := make([]string, 0, len(chunks))
+	for idx, item := range chunks {
+		part := fmt.Sprintf(" (%d/%d)", idx+1, len(chunks))
+		if t.parseMode == TelegramMarkdownV2 {
+			part = telegramEscaper.Replace(part)
+		}
+		result = append(result, title+part+"\n"+open+item+end)
+	}
+	return result
+}
+
+// send notify 为 false 时, 静默发送
+func (t *telegram) send(chatID, text string, notify bool) (string, error) {
+	bs, _ := json.Marshal(map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"parse_mode":               t.parseMode,
+		"disable_web_page_preview": true,
+		"disable_notification":     !notify,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewBuffer(bs))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	r := new(struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	})
+	_ = json.Unmarshal(result, r)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(time.Duration(r.Parameters.RetryAfter)*time.Second,
+			"telegram response %s: %s", resp.Status, r.Description)
+	}
+	if !r.OK {
+		return "", errors.Errorf("telegram response %s: %s", resp.Status, r.Description)
+	}
+	return string(result), nil
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import "strings"
+
+// limitText 按字符截断, 超出部分用 ... 代替
+func limitText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-3]) + "..."
+}
+
+// splitText 按行拆分 content, 转义后每段的 length 不超过 limit
+// 单行超过 limit 时, 按字符拆分
+func splitText(content string, limit int, escape func(string) string, length func(string) int) []string {
+	result := make([]string, 0, 1)
+	current := ""
+	size := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		for len(line) > 0 {
+			piece := line
+			escaped := escape(piece)
+			n := length(escaped)
+			for n > limit {
+				runes := []rune(piece)
+				if len(runes) == 1 {
+					break
+				}
+				piece = string(runes[:len(runes)/2])
+				escaped = escape(piece)
+				n = length(escaped)
+			}
+			if size+n > limit {
+				result = append(result, current)
+				current, size = "", 0
+			}
+			current += escaped
+			size += n
+			line = line[len(piece):]
+		}
+	}
+	if size > 0 || len(result) == 0 {
+		result = append(result, current)
+	}
+	return result
+}
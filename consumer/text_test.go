@@ -0,0 +1,59 @@
+package consumer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	noEscape := func(s string) string { return s }
+	underscore := func(s string) string {
+		return strings.ReplaceAll(s, "_", `\_`)
+	}
+	tests := []struct {
+		name    string
+		content string
+		limit   int
+		escape  func(string) string
+		want    []string
+	}{
+		{"empty", "", 10, noEscape, []string{""}},
+		{"fits", "abc\ndef", 10, noEscape, []string{"abc\ndef"}},
+		{"by line", "aaa\nbbb\nccc", 8, noEscape, []string{"aaa\nbbb\n", "ccc"}},
+		{"long line", "abcdefghij", 4, noEscape, []string{"ab", "cdef", "ghij"}},
+		{"runes", "你好世界", 2, noEscape, []string{"你好", "世界"}},
+		{"escaped length", "a_b_c_d", 4, underscore, []string{`a\_b`, `\_c`, `\_d`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.content, tt.limit, tt.escape, utf8.RuneCountInString)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitText() = %q, want %q", got, tt.want)
+			}
+			for _, item := range got {
+				if utf8.RuneCountInString(item) > tt.limit {
+					t.Fatalf("chunk %q is longer than %d", item, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitText(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"abc", 3, "abc"},
+		{"abcdef", 5, "ab..."},
+		{"你好世界你好", 5, "你好..."},
+	}
+	for _, tt := range tests {
+		if got := limitText(tt.text, tt.limit); got != tt.want {
+			t.Errorf("limitText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
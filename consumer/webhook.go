@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// defaultWebhookBody 未配置 body 时, 发送 json 格式的完整消息
+const defaultWebhookBody = `{{json .}}`
+
+type webhook struct {
+	url     string
+	method  string
+	headers map[string]string
+	body    *template.Template
+}
+
+// newWebhook body 为 text/template 模板, 数据为 *Message
+// 额外提供 json, join 两个函数
+func newWebhook(url, method string, headers map[string]string, body string) (*webhook, error) {
+	if len(method) == 0 {
+		method = http.MethodPost
+	}
+	if len(body) == 0 {
+		body = defaultWebhookBody
+	}
+	tpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			bs, err := json.Marshal(v)
+			return string(bs), err
+		},
+		"join": strings.Join,
+	}).Parse(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not parse webhook body template")
+	}
+	return &webhook{
+		url:     url,
+		method:  strings.ToUpper(method),
+		headers: headers,
+		body:    tpl,
+	}, nil
+}
+
+func (w *webhook) Send(msg *Message) (string, error) {
+	buffer := bytes.NewBufferString("")
+	err := w.body.Execute(buffer, msg)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest(w.method, w.url, buffer)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", newThrottledError(retryAfter(resp), "webhook response %s: %s", resp.Status, result)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", errors.Errorf("webhook response %s: %s", resp.Status, result)
+	}
+	return string(result), nil
+}
@@ -0,0 +1,130 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// wecomMarkdownLimit markdown 内容最大字节数
+// https://developer.work.weixin.qq.com/document/path/91770
+const wecomMarkdownLimit = 4096
+
+// wecomColors 将 lark 的 template 颜色映射为企业微信 markdown 支持的颜色
+var wecomColors = map[string]string{
+	"red":       "warning",
+	"carmine":   "warning",
+	"orange":    "warning",
+	"yellow":    "warning",
+	"green":     "info",
+	"turquoise": "info",
+}
+
+type wecom struct {
+	url     string
+	mobiles []string // at someones
+}
+
+func newWecom(url string, mobiles []string) *wecom {
+	return &wecom{
+		url:     url,
+		mobiles: mobiles,
+	}
+}
+
+func (w *wecom) Send(msg *Message) (string, error) {
+	response, _, err := w.sendParts(msg, nil)
+	return response, err
+}
+
+// sendParts markdown 分段的序号从 0 开始, @ 相关人员的 text 消息序号为分段数量
+// markdown 消息不支持 mentioned_mobile_list, 需要 @ 相关人员时, 额外发送一条 text 消息
+func (w *wecom) sendParts(msg *Message, done map[int]bool) (string, []int, error) {
+	color, ok := wecomColors[msg.Color]
+	if !ok {
+		color = "comment"
+	}
+	title := `<font color="` + color + `">**` + msg.Title + "**</font>\n"
+
+	noEscape := func(s string) string { return s }
+	length := func(s string) int { return len(s) }
+	chunks := splitText(msg.Content, wecomMarkdownLimit-len(title), noEscape, length)
+	bodies := make([]*wecomBody, 0, len(chunks)+1)
+	for _, item := range chunks {
+		temp := &wecomBody{MsgType: "markdown"}
+		temp.Markdown = &wecomText{Content: title + item}
+		bodies = append(bodies, temp)
+	}
+	mobiles := append(append([]string{}, w.mobiles...), msg.Mobiles...)
+	if msg.Notify && len(mobiles) > 0 {
+		temp := &wecomBody{MsgType: "text"}
+		temp.Text = &wecomText{
+			Content:             msg.Title,
+			MentionedMobileList: mobiles,
+		}
+		bodies = append(bodies, temp)
+	}
+
+	var response string
+	sent := make([]int, 0)
+	for idx, item := range bodies {
+		if done[idx] {
+			continue
+		}
+		temp, err := w.send(item)
+		if err != nil {
+			return response, sent, err
+		}
+		response = temp
+		sent = append(sent, idx)
+	}
+	return response, sent, nil
+}
+
+func (w *wecom) send(temp *wecomBody) (string, error) {
+	bs, _ := json.Marshal(temp)
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewBuffer(bs))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := io.ReadAll(resp.Body)
+	r := new(struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	})
+	err = json.Unmarshal(result, r)
+	if err != nil {
+		return "", errors.Wrapf(err, "wecom response %s: %s", resp.Status, result)
+	}
+	// 45009: 接口调用超过限制
+	if r.ErrCode == 45009 {
+		return "", newThrottledError(0, "wecom response %d: %s", r.ErrCode, r.ErrMsg)
+	}
+	if r.ErrCode != 0 {
+		return "", errors.Errorf("wecom response %d: %s", r.ErrCode, r.ErrMsg)
+	}
+	return string(result), nil
+}
+
+type wecomBody struct {
+	MsgType  string     `json:"msgtype"`
+	Markdown *wecomText `json:"markdown,omitempty"`
+	Text     *wecomText `json:"text,omitempty"`
+}
+
+type wecomText struct {
+	Content             string   `json:"content"`
+	MentionedMobileList []string `json:"mentioned_mobile_list,omitempty"`
+}
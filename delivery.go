@@ -0,0 +1,35 @@
+package flr
+
+import (
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+)
+
+// record 记录每个 target 的发送结果, 返回第一个错误
+func (p *Processor) record(results consumer.Results) error {
+	for _, item := range results {
+		notificationsTotal.WithLabelValues(p.conf.Name, item.Channel, item.Target, item.Outcome).Inc()
+		if item.Outcome != consumer.OutcomeSuppressed {
+			notificationDuration.WithLabelValues(p.conf.Name, item.Channel, item.Target).Observe(item.Latency.Seconds())
+		}
+
+		entry := log.Entry.WithField("job", p.conf.Name).
+			WithField("channel", item.Channel).
+			WithField("target", item.Target).
+			WithField("outcome", item.Outcome).
+			WithField("latency", item.Latency.String())
+		if item.Retry {
+			entry = entry.WithField("retry", true)
+		}
+		if item.Err != nil {
+			entry.WithError(item.Err).Warn("send failed")
+			continue
+		}
+		if item.Outcome == consumer.OutcomeSuppressed {
+			entry.Warn("send suppressed by rate limit")
+			continue
+		}
+		entry.WithField("response", item.Response).Debug("send")
+	}
+	return results.Err()
+}
@@ -0,0 +1,139 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Bucket 一个分组的统计结果
+type Bucket struct {
+	Values   []string // 与 groupKeys 一一对应, 缺失时为空
+	Missing  []bool
+	Count    int
+	LastTime int64 // 毫秒
+	Sample   json.RawMessage
+}
+
+const (
+	groupsAggName   = "groups"
+	lastTimeAggName = "last_time"
+	sampleAggName   = "sample"
+)
+
+// AggregateByRange 由 es 完成分组统计, 每个分组只返回最新的一条日志
+// 样例日志只包含 sampleKeys 中的字段, 为空时不返回样例日志的内容
+// 使用 composite aggregation 分页, 最多返回 MaxDocs 个分组, 还有更多分组时返回 truncated = true
+func (c *Client) AggregateByRange(gte, lte int64, groupKeys, sampleKeys []string, conf *Config) (result []*Bucket, truncated bool, err error) {
+	result = make([]*Bucket, 0)
+	var after map[string]interface{}
+	for {
+		size := conf.getPageSize(len(result))
+		sb := newSearchBody(gte, lte, conf)
+		sb.Sort = nil
+		sb.Aggs = newGroupsAggs(groupKeys, sampleKeys, size, after, conf)
+
+		r, err := c.search(
+			c.client.Search.WithContext(context.Background()),
+			c.client.Search.WithIndex(conf.Index),
+			c.client.Search.WithBody(bytes.NewBufferString(sb.String())),
+			c.client.Search.WithSize(0),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		groups := r.Aggregations.Groups
+		for _, item := range groups.Buckets {
+			result = append(result, item.toBucket(len(groupKeys)))
+		}
+		if len(groups.Buckets) < size || len(groups.AfterKey) == 0 {
+			return result, false, nil
+		}
+		if len(result) >= conf.getMaxDocs() {
+			// 分组数量恰好为 MaxDocs 时, 也视为已截断
+			return result, true, nil
+		}
+		after = groups.AfterKey
+	}
+}
+
+func newGroupsAggs(groupKeys, sampleKeys []string, size int, after map[string]interface{}, conf *Config) map[string]interface{} {
+	sources := make([]interface{}, 0, len(groupKeys))
+	for idx, key := range groupKeys {
+		sources = append(sources, map[string]interface{}{
+			sourceName(idx): map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field":          key,
+					"missing_bucket": true,
+				},
+			},
+		})
+	}
+
+	composite := map[string]interface{}{
+		"size":    size,
+		"sources": sources,
+	}
+	if after != nil {
+		composite["after"] = after
+	}
+
+	topHits := map[string]interface{}{
+		"size": 1,
+		"sort": []interface{}{
+			map[string]string{conf.RangeTimeName: "desc"},
+		},
+	}
+	if len(sampleKeys) > 0 {
+		topHits["_source"] = map[string]interface{}{
+			"includes": sampleKeys,
+		}
+	} else {
+		topHits["_source"] = false
+	}
+
+	return map[string]interface{}{
+		groupsAggName: map[string]interface{}{
+			"composite": composite,
+			"aggs": map[string]interface{}{
+				lastTimeAggName: map[string]interface{}{
+					"max": map[string]string{"field": conf.RangeTimeName},
+				},
+				sampleAggName: map[string]interface{}{
+					"top_hits": topHits,
+				},
+			},
+		},
+	}
+}
+
+func sourceName(idx int) string {
+	return fmt.Sprintf("g%d", idx)
+}
+
+func (b *groupsBucket) toBucket(keys int) *Bucket {
+	bucket := &Bucket{
+		Values:  make([]string, keys),
+		Missing: make([]bool, keys),
+		Count:   b.DocCount,
+	}
+	for idx := 0; idx < keys; idx++ {
+		value, ok := b.Key[sourceName(idx)]
+		if !ok || value == nil {
+			bucket.Missing[idx] = true
+			continue
+		}
+		bucket.Values[idx] = fmt.Sprint(value)
+	}
+
+	lastTime, err := b.LastTime.Value.Float64()
+	if err == nil {
+		bucket.LastTime = int64(lastTime)
+	}
+	if len(b.Sample.Hits.Hits) > 0 {
+		bucket.Sample = b.Sample.Hits.Hits[0].Source
+	}
+	return bucket
+}
@@ -0,0 +1,60 @@
+package es
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregateByRange(t *testing.T) {
+	pages := []string{
+		`{"aggregations":{"groups":{"after_key":{"g0":"eth","g1":2},"buckets":[
+			{"key":{"g0":"btc","g1":1},"doc_count":3,"last_time":{"value":1700000000123},
+			 "sample":{"hits":{"hits":[{"_source":{"message":"boom"}}]}}},
+			{"key":{"g0":"eth","g1":2},"doc_count":1,"last_time":{"value":1700000000456},
+			 "sample":{"hits":{"hits":[]}}}]}}}`,
+		`{"aggregations":{"groups":{"after_key":{"g0":null,"g1":3},"buckets":[
+			{"key":{"g0":null,"g1":3},"doc_count":2,"last_time":{"value":1700000000789},
+			 "sample":{"hits":{"hits":[{"_source":{"message":"oops"}}]}}}]}}}`,
+	}
+	want := []*Bucket{
+		{Values: []string{"btc", "1"}, Missing: []bool{false, false}, Count: 3, LastTime: 1700000000123, Sample: []byte(`{"message":"boom"}`)},
+		{Values: []string{"eth", "2"}, Missing: []bool{false, false}, Count: 1, LastTime: 1700000000456},
+		{Values: []string{"", "3"}, Missing: []bool{true, false}, Count: 2, LastTime: 1700000000789, Sample: []byte(`{"message":"oops"}`)},
+	}
+
+	tests := []struct {
+		name      string
+		maxDocs   int
+		want      []*Bucket
+		truncated bool
+		afters    []string
+	}{
+		{"all pages", 10, want, false, []string{"", `{"g0":"eth","g1":2}`}},
+		{"truncated", 2, want[:2], true, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeEs{aggPages: pages}
+			c := newFakeEs(t, f)
+			result, truncated, err := c.AggregateByRange(0, 10, []string{"chain", "code"}, []string{"message"}, &Config{
+				Index:         "logs",
+				Size:          2,
+				MaxDocs:       tt.maxDocs,
+				RangeTimeName: "time",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if truncated != tt.truncated {
+				t.Fatalf("truncated = %v, want %v", truncated, tt.truncated)
+			}
+			if !reflect.DeepEqual(result, tt.want) {
+				t.Fatalf("got %d buckets, want %d", len(result), len(tt.want))
+			}
+			// 下一页从上一页的 after_key 开始
+			if !reflect.DeepEqual(f.afters, tt.afters) {
+				t.Fatalf("afters = %q, want %q", f.afters, tt.afters)
+			}
+		})
+	}
+}
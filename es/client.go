@@ -4,10 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"github.com/pkg/errors"
+
+	"github.com/LukeEuler/funnel-log-reporter/log"
+)
+
+const (
+	keepAlive        = time.Minute
+	pitKeepAlive     = "1m" // es 的时间格式, 与 keepAlive 一致, 不能使用 time.Duration.String()
+	defaultMaxDocs   = 10000
+	defaultPageSize  = 1000
+	pitNotSupportTip = "open point in time failed, fallback to scroll"
 )
 
 type Client struct {
@@ -30,87 +41,230 @@ func NewClient(address []string, user, password string) (*Client, error) {
 
 type Config struct {
 	Index         string
-	Size          int
+	Size          int // 每页数量
+	MaxDocs       int // 每次最多获取的数量
 	RangeTimeName string
 	Terms         []*Term
 }
 
+func (c *Config) getPageSize(fetched int) int {
+	size := c.Size
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	if left := c.getMaxDocs() - fetched; left < size {
+		size = left
+	}
+	return size
+}
+
+func (c *Config) getMaxDocs() int {
+	if c.MaxDocs <= 0 {
+		return defaultMaxDocs
+	}
+	return c.MaxDocs
+}
+
 type Term struct {
 	Key   string
 	Value []string
 }
 
-// getMessageByRange 根据  gte~lte 获取相关 messages
-// 一旦发现返回数据两超过 size，则利用 getMoreMessageByRange 获取更多数据
-func (c *Client) GetMessageByRange(gte, lte int64, conf *Config) ([]json.RawMessage, error) {
+// GetMessageByRange 根据 gte~lte 获取相关 messages, 按时间升序
+// 优先使用 point in time + search_after 分页, 集群不支持时(< 7.10)使用 scroll
+// 最多获取 MaxDocs 条, 超出的部分返回 truncated = true, 此时保留较早的日志
+// 调用方从最后一条日志的时间(包含)开始继续获取, 并去掉重复的日志
+func (c *Client) GetMessageByRange(gte, lte int64, conf *Config) (result []json.RawMessage, truncated bool, err error) {
+	pitID, err := c.openPointInTime(conf.Index)
+	if err != nil {
+		log.Entry.WithError(err).WithField("index", conf.Index).Warn(err)
+		return c.getMessageByScroll(gte, lte, conf)
+	}
+	defer func() {
+		c.closePointInTime(pitID)
+	}()
+
+	result = make([]json.RawMessage, 0, conf.getPageSize(0))
+	var searchAfter []interface{}
+	for {
+		size := conf.getPageSize(len(result))
+		sb := newSearchBody(gte, lte, conf)
+		sb.Size = size
+		sb.Pit = &pointInTime{ID: pitID, KeepAlive: pitKeepAlive}
+		sb.SearchAfter = searchAfter
+
+		r, err := c.search(
+			c.client.Search.WithContext(context.Background()),
+			c.client.Search.WithBody(bytes.NewBufferString(sb.String())),
+			c.client.Search.WithTrackTotalHits(true),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(r.PitID) > 0 {
+			pitID = r.PitID
+		}
+
+		hits := r.Hits.Hits
+		result = append(result, r.getSource()...)
+		if len(hits) < size {
+			return result, false, nil
+		}
+		if len(result) >= conf.getMaxDocs() {
+			return result, r.Hits.Total.Value > len(result), nil
+		}
+		searchAfter = hits[len(hits)-1].Sort
+	}
+}
+
+// getMessageByScroll 用于不支持 point in time 的旧版本集群
+func (c *Client) getMessageByScroll(gte, lte int64, conf *Config) ([]json.RawMessage, bool, error) {
 	sb := newSearchBody(gte, lte, conf)
-	fmt.Println(sb)
-	res, err := c.client.Search(
+	r, err := c.search(
 		c.client.Search.WithContext(context.Background()),
 		c.client.Search.WithIndex(conf.Index),
 		c.client.Search.WithBody(bytes.NewBufferString(sb.String())),
 		c.client.Search.WithTrackTotalHits(true),
-		c.client.Search.WithSize(conf.Size),
-		c.client.Search.WithSort(conf.RangeTimeName+":asc"),
+		c.client.Search.WithSize(conf.getPageSize(0)),
+		c.client.Search.WithScroll(keepAlive),
 	)
+	if err != nil {
+		return nil, false, err
+	}
+	scrollID := r.ScrollID
+	defer func() {
+		c.clearScroll(scrollID)
+	}()
+
+	total := r.Hits.Total.Value
+	result := make([]json.RawMessage, 0, conf.getPageSize(0))
+	for {
+		result = append(result, r.getSource()...)
+		if len(result) >= conf.getMaxDocs() {
+			return result[:conf.getMaxDocs()], total > conf.getMaxDocs(), nil
+		}
+		if len(r.Hits.Hits) == 0 || len(result) >= total {
+			return result, false, nil
+		}
+
+		r, err = c.scroll(
+			c.client.Scroll.WithContext(context.Background()),
+			c.client.Scroll.WithScrollID(scrollID),
+			c.client.Scroll.WithScroll(keepAlive),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(r.ScrollID) > 0 {
+			scrollID = r.ScrollID
+		}
+	}
+}
+
+func (c *Client) search(o ...func(*esapi.SearchRequest)) (*searchResponse, error) {
+	res, err := c.client.Search(o...)
+	return decodeSearchResponse(res, err)
+}
+
+func (c *Client) scroll(o ...func(*esapi.ScrollRequest)) (*searchResponse, error) {
+	res, err := c.client.Scroll(o...)
+	return decodeSearchResponse(res, err)
+}
+
+func decodeSearchResponse(res *esapi.Response, err error) (*searchResponse, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		var e map[string]interface{}
-		err = json.NewDecoder(res.Body).Decode(&e)
-		if err != nil {
-			return nil, errors.WithMessage(err, "Error parsing the response body")
-		}
-		// Print the response status and error information.
-		return nil, errors.Errorf("[%s] %s: %s",
-			res.Status(),
-			e["error"].(map[string]interface{})["type"],
-			e["error"].(map[string]interface{})["reason"])
+		return nil, responseError(res)
 	}
 
 	r := new(searchResponse)
-	err = json.NewDecoder(res.Body).Decode(r)
+	// sort 中的值用于 search_after, 避免转换为 float64 丢失精度
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	err = decoder.Decode(r)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	return r, nil
+}
+
+func (c *Client) openPointInTime(index string) (string, error) {
+	res, err := c.client.OpenPointInTime([]string{index}, pitKeepAlive,
+		c.client.OpenPointInTime.WithContext(context.Background()))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", errors.WithMessage(responseError(res), pitNotSupportTip)
+	}
+
+	r := new(pointInTime)
+	err = json.NewDecoder(res.Body).Decode(r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if len(r.ID) == 0 {
+		return "", errors.New(pitNotSupportTip)
+	}
+	return r.ID, nil
+}
 
-	if r.Hits.Total.Value <= conf.Size {
-		return r.getSource(), nil
+// closePointInTime 失败时等待 keep alive 过期即可
+func (c *Client) closePointInTime(id string) {
+	bs, _ := json.Marshal(&pointInTime{ID: id})
+	res, err := c.client.ClosePointInTime(
+		c.client.ClosePointInTime.WithContext(context.Background()),
+		c.client.ClosePointInTime.WithBody(bytes.NewBuffer(bs)),
+	)
+	if err == nil {
+		res.Body.Close()
 	}
+}
 
-	// r.Hits.Total > size
-	return c.getMoreMessageByRange(gte, lte, r.Hits.Total.Value, conf)
+// clearScroll 失败时等待 keep alive 过期即可
+func (c *Client) clearScroll(id string) {
+	if len(id) == 0 {
+		return
+	}
+	res, err := c.client.ClearScroll(
+		c.client.ClearScroll.WithContext(context.Background()),
+		c.client.ClearScroll.WithScrollID(id),
+	)
+	if err == nil {
+		res.Body.Close()
+	}
 }
 
-// getMoreMessageByRange 通过将 gte~lte 拆分以减少每次查询的数量
-func (c *Client) getMoreMessageByRange(gte, lte int64, total int, conf *Config) ([]json.RawMessage, error) {
-	if lte-gte == 1 {
-		// TODO
-		conf.Size = total
+// Ping 检查 es 是否可以访问
+func (c *Client) Ping(ctx context.Context) error {
+	res, err := c.client.Ping(c.client.Ping.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	k := total / conf.Size
-	if k*conf.Size < total {
-		k++
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.Errorf("[%s] ping failed", res.Status())
 	}
+	return nil
+}
 
-	result := make([]json.RawMessage, 0, total)
-	step := (lte - gte) / int64(k)
-	if step < 1 {
-		step = 1
+func responseError(res *esapi.Response) error {
+	var e struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
 	}
-	for a := gte; a < lte; a += step {
-		b := a + step
-		if b > lte {
-			b = lte
-		}
-		mid, err := c.GetMessageByRange(a, b, conf)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
-		result = append(result, mid...)
+	err := json.NewDecoder(res.Body).Decode(&e)
+	if err != nil {
+		return errors.WithMessagef(err, "[%s] Error parsing the response body", res.Status())
 	}
-	return result, nil
+	// Print the response status and error information.
+	return errors.Errorf("[%s] %s: %s", res.Status(), e.Error.Type, e.Error.Reason)
 }
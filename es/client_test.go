@@ -0,0 +1,158 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeEs 按时间升序返回 docs, 支持 point in time 与 scroll 分页, 以及 composite aggregation
+type fakeEs struct {
+	t     *testing.T
+	docs  []int64 // 每条日志的时间
+	noPit bool    // 模拟不支持 point in time 的旧版本集群
+
+	// scroll 的每页数量与下一页的位置
+	scrollSize, scrollFrom int
+	closed                 int
+
+	// 聚合请求按页返回 aggPages, 并记录每次请求的 after
+	aggPages []string
+	afters   []string
+}
+
+func newFakeEs(t *testing.T, f *fakeEs) *Client {
+	f.t = t
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	c, err := NewClient([]string{server.URL}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (f *fakeEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+	body := make(map[string]json.RawMessage)
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.URL.Path == "/":
+		f.write(w, `{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`)
+	case strings.HasSuffix(r.URL.Path, "/_pit") && r.Method == http.MethodPost:
+		if f.noPit {
+			w.WriteHeader(http.StatusBadRequest)
+			f.write(w, `{"error":{"type":"parse_exception","reason":"no pit"}}`)
+			return
+		}
+		f.write(w, `{"id":"pit"}`)
+	case r.URL.Path == "/_pit" && r.Method == http.MethodDelete:
+		f.closed++
+		f.write(w, `{"succeeded":true}`)
+	case r.URL.Path == "/_search":
+		size, _ := strconv.Atoi(string(body["size"]))
+		from := 0
+		var after []json.Number
+		if len(body["search_after"]) > 0 {
+			_ = json.Unmarshal(body["search_after"], &after)
+			last, _ := after[0].Int64()
+			for from < len(f.docs) && f.docs[from] <= last {
+				from++
+			}
+		}
+		f.write(w, f.page(from, size, `"pit_id":"pit"`))
+	case strings.HasSuffix(r.URL.Path, "/_search") && len(body["aggs"]) > 0:
+		var aggs struct {
+			Groups struct {
+				Composite struct {
+					After json.RawMessage `json:"after"`
+				} `json:"composite"`
+			} `json:"groups"`
+		}
+		_ = json.Unmarshal(body["aggs"], &aggs)
+		f.afters = append(f.afters, string(aggs.Groups.Composite.After))
+		f.write(w, f.aggPages[0])
+		f.aggPages = f.aggPages[1:]
+	case strings.HasSuffix(r.URL.Path, "/_search"):
+		f.scrollSize, _ = strconv.Atoi(r.URL.Query().Get("size"))
+		f.scrollFrom = f.scrollSize
+		f.write(w, f.page(0, f.scrollSize, `"_scroll_id":"scroll"`))
+	case strings.HasPrefix(r.URL.Path, "/_search/scroll/") && r.Method == http.MethodDelete:
+		f.closed++
+		f.write(w, `{"succeeded":true}`)
+	case r.URL.Path == "/_search/scroll":
+		if r.URL.Query().Get("scroll_id") != "scroll" {
+			f.t.Errorf("scroll id = %s", r.URL.Query().Get("scroll_id"))
+		}
+		from := f.scrollFrom
+		f.scrollFrom += f.scrollSize
+		f.write(w, f.page(from, f.scrollSize, `"_scroll_id":"scroll"`))
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeEs) page(from, size int, extra string) string {
+	hits := make([]string, 0, size)
+	for idx := from; idx < len(f.docs) && idx < from+size; idx++ {
+		hits = append(hits, fmt.Sprintf(`{"_id":"%d","_source":{"time":%d},"sort":[%d]}`,
+			idx, f.docs[idx], f.docs[idx]))
+	}
+	return fmt.Sprintf(`{%s,"hits":{"total":{"value":%d,"relation":"eq"},"hits":[%s]}}`,
+		extra, len(f.docs), strings.Join(hits, ","))
+}
+
+func (f *fakeEs) write(w http.ResponseWriter, body string) {
+	_, _ = w.Write([]byte(body))
+}
+
+func TestGetMessageByRange(t *testing.T) {
+	docs := []int64{1, 2, 3, 4, 5}
+	tests := []struct {
+		name      string
+		noPit     bool
+		maxDocs   int
+		want      int
+		truncated bool
+	}{
+		{"pit", false, 10, 5, false},
+		{"pit truncated", false, 4, 4, true},
+		{"pit exactly max docs", false, 5, 5, false},
+		{"scroll", true, 10, 5, false},
+		{"scroll truncated", true, 3, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeEs{docs: docs, noPit: tt.noPit}
+			c := newFakeEs(t, f)
+			result, truncated, err := c.GetMessageByRange(0, 10, &Config{
+				Index:         "logs",
+				Size:          2,
+				MaxDocs:       tt.maxDocs,
+				RangeTimeName: "time",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result) != tt.want || truncated != tt.truncated {
+				t.Fatalf("got %d docs, truncated %v, want %d, %v", len(result), truncated, tt.want, tt.truncated)
+			}
+			// 保留较早的日志
+			for idx, item := range result {
+				if string(item) != fmt.Sprintf(`{"time":%d}`, docs[idx]) {
+					t.Fatalf("result[%d] = %s", idx, item)
+				}
+			}
+			if f.closed != 1 {
+				t.Fatalf("point in time or scroll closed %d times, want 1", f.closed)
+			}
+		})
+	}
+}
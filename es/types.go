@@ -10,6 +10,17 @@ type searchBody struct {
 			Must []interface{} `json:"must"`
 		} `json:"bool"`
 	} `json:"query"`
+	Size        int           `json:"size,omitempty"`
+	Sort        []interface{} `json:"sort,omitempty"`
+	SearchAfter []interface{} `json:"search_after,omitempty"`
+	Pit         *pointInTime  `json:"pit,omitempty"`
+
+	Aggs map[string]interface{} `json:"aggs,omitempty"`
+}
+
+type pointInTime struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 func (b *searchBody) String() string {
@@ -48,14 +59,21 @@ func newSearchBody(gte, lte int64, conf *Config) *searchBody {
 		}
 		sb.Query.Bool.Must = append(sb.Query.Bool.Must, st)
 	}
+
+	// 使用 point in time 时, es 会自动追加 _shard_doc 作为 tiebreaker
+	sb.Sort = []interface{}{
+		map[string]string{conf.RangeTimeName: "asc"},
+	}
 	return sb
 }
 
 // response
 
 type searchResponse struct {
-	Took     int  `json:"took"`
-	TimedOut bool `json:"timed_out"`
+	PitID    string `json:"pit_id"`
+	ScrollID string `json:"_scroll_id"`
+	Took     int    `json:"took"`
+	TimedOut bool   `json:"timed_out"`
 	Shards   struct {
 		Total      int `json:"total"`
 		Successful int `json:"successful"`
@@ -74,8 +92,30 @@ type searchResponse struct {
 			ID     string          `json:"_id"`
 			Score  json.Number     `json:"_score"`
 			Source json.RawMessage `json:"_source"`
+			Sort   []interface{}   `json:"sort"`
 		} `json:"hits"`
 	} `json:"hits"`
+	Aggregations struct {
+		Groups struct {
+			AfterKey map[string]interface{} `json:"after_key"`
+			Buckets  []*groupsBucket        `json:"buckets"`
+		} `json:"groups"`
+	} `json:"aggregations"`
+}
+
+type groupsBucket struct {
+	Key      map[string]interface{} `json:"key"`
+	DocCount int                    `json:"doc_count"`
+	LastTime struct {
+		Value json.Number `json:"value"`
+	} `json:"last_time"`
+	Sample struct {
+		Hits struct {
+			Hits []*struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	} `json:"sample"`
 }
 
 func (r *searchResponse) getSource() []json.RawMessage {
@@ -0,0 +1,92 @@
+package flr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+)
+
+// escalation 分组持续报警的状态, 分组恢复或被屏蔽后清除
+type escalation struct {
+	Since  time.Time `json:"since"`
+	Cycles int       `json:"cycles"`
+	Tier   int       `json:"tier"` // 已经通知过的 tier 数量
+}
+
+func reached(tier *config.EscalationTier, item *escalation, now time.Time) bool {
+	if tier.After > 0 && now.Sub(item.Since) >= time.Duration(tier.After)*time.Second {
+		return true
+	}
+	return tier.Cycles > 0 && item.Cycles >= tier.Cycles
+}
+
+// escalate 记录每个分组持续报警的时间与周期数, 达到 tier 的条件时重新发送报警, 并 @ 该 tier 的人员
+// groups 为本轮仍在报警的分组
+func (p *Processor) escalate(groups []*consumer.Group) {
+	now := time.Now()
+	firing := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		firing[group.Tag] = true
+		item, ok := p.escalations[group.Tag]
+		if !ok {
+			item = &escalation{Since: now}
+			p.escalations[group.Tag] = item
+		}
+		item.Cycles++
+	}
+	for tag := range p.escalations {
+		if !firing[tag] {
+			delete(p.escalations, tag)
+		}
+	}
+	defer p.setActive(groups)
+
+	if p.conf.Escalation == nil || len(p.conf.Escalation.Tiers) == 0 {
+		return
+	}
+	tiers := p.conf.Escalation.Tiers
+
+	// 一个分组在同一轮中跨越多个 tier 时, 只按最高的 tier 通知
+	collection := make([][]*consumer.Group, len(tiers))
+	for _, group := range groups {
+		item := p.escalations[group.Tag]
+		tier := item.Tier
+		for tier < len(tiers) && reached(tiers[tier], item, now) {
+			tier++
+		}
+		if tier == item.Tier {
+			continue
+		}
+		item.Tier = tier
+		collection[tier-1] = append(collection[tier-1], group)
+	}
+
+	for idx, list := range collection {
+		if len(list) == 0 {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return p.escalations[list[i].Tag].Since.Before(p.escalations[list[j].Tag].Since)
+		})
+		lines := make([]string, 0, len(list))
+		for _, group := range list {
+			item := p.escalations[group.Tag]
+			lines = append(lines, fmt.Sprintf("%s 已持续 %s, %d 个检查周期",
+				group.Values, now.Sub(item.Since).Truncate(time.Second), item.Cycles))
+		}
+
+		tier := tiers[idx]
+		title := fmt.Sprintf("持续报警未恢复, 升级至第 %d/%d 级: %d 个分组", idx+1, len(tiers), len(list))
+		msg := p.newAlertMessage(title, list, joinLines(lines...))
+		msg.Notify = true
+		addMentions(msg, tier.Mentions)
+		err := p.send(msg)
+		if err != nil {
+			log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package flr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+func TestEscalate(t *testing.T) {
+	conf := new(config.Job)
+	conf.Escalation = &config.Escalation{Tiers: []*config.EscalationTier{
+		{Cycles: 2, Mentions: config.Mentions{Mobiles: []string{"a"}}},
+		{Cycles: 3, Mentions: config.Mentions{Mobiles: []string{"b"}}},
+		{After: 3600, Mentions: config.Mentions{Mobiles: []string{"c"}}},
+	}}
+	p, recorder := newTestProcessor(t, conf)
+	group := &consumer.Group{Tag: "a", Values: []string{"a"}}
+
+	// 第 1 轮未达到条件, 之后每轮升级一级, 每个 tier 只通知一次
+	want := [][]string{nil, {"a"}, {"b"}, nil}
+	for idx, mobiles := range want {
+		before := len(recorder.all())
+		p.escalate([]*consumer.Group{group})
+		messages := recorder.all()[before:]
+		if mobiles == nil {
+			if len(messages) != 0 {
+				t.Fatalf("cycle %d: messages = %+v, want none", idx+1, messages)
+			}
+			continue
+		}
+		if len(messages) != 1 || !reflect.DeepEqual(messages[0].Mobiles, mobiles) {
+			t.Fatalf("cycle %d: messages = %+v, want one mentioning %v", idx+1, messages, mobiles)
+		}
+	}
+
+	// 同一轮跨越多个 tier 时只按最高的 tier 通知
+	p.escalations["b"] = &escalation{Since: time.Now().Add(-2 * time.Hour), Cycles: 5}
+	before := len(recorder.all())
+	p.escalate([]*consumer.Group{group, {Tag: "b", Values: []string{"b"}}})
+	messages := recorder.all()[before:]
+	if len(messages) != 1 || !reflect.DeepEqual(messages[0].Mobiles, []string{"c"}) ||
+		!strings.Contains(messages[0].Title, "3/3") || len(messages[0].Groups) != 1 {
+		t.Fatalf("messages = %+v, want one tier 3 message for b", messages)
+	}
+	if p.escalations["b"].Tier != 3 {
+		t.Fatalf("tier = %d, want 3", p.escalations["b"].Tier)
+	}
+
+	// 恢复后清除, 再次报警时重新计算
+	p.escalate([]*consumer.Group{group})
+	if _, ok := p.escalations["b"]; ok {
+		t.Fatal("escalation of resolved group should be removed")
+	}
+}
@@ -0,0 +1,140 @@
+package flr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/source"
+)
+
+// cycles 检查周期的运行情况, 用于 /healthz 与 /readyz
+type cycles struct {
+	mu sync.Mutex
+	cycleState
+}
+
+type cycleState struct {
+	started     time.Time // processor 创建的时间
+	lastRun     time.Time // 最近一次检查开始的时间
+	lastFinish  time.Time
+	lastSuccess time.Time
+	lastError   string
+}
+
+func newCycles() *cycles {
+	return &cycles{cycleState: cycleState{started: time.Now()}}
+}
+
+func (c *cycles) get() cycleState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cycleState
+}
+
+func (c *cycles) begin() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRun = time.Now()
+}
+
+func (c *cycles) end(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastFinish = time.Now()
+	if err != nil {
+		c.lastError = err.Error()
+		return
+	}
+	c.lastSuccess = c.lastFinish
+	c.lastError = ""
+}
+
+type jobStatus struct {
+	Job         string              `json:"job"`
+	OK          bool                `json:"ok"`
+	Reasons     []string            `json:"reasons,omitempty"`
+	LastRun     *time.Time          `json:"last_run,omitempty"`
+	LastFinish  *time.Time          `json:"last_finish,omitempty"`
+	LastSuccess *time.Time          `json:"last_success,omitempty"`
+	LastError   string              `json:"last_error,omitempty"`
+	Source      *sourceStatus       `json:"source,omitempty"`
+	Channels    map[string][]string `json:"channels"` // 每个 channel 已配置的 target
+}
+
+type sourceStatus struct {
+	Type      string `json:"type"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (s *jobStatus) fail(format string, args ...interface{}) {
+	s.OK = false
+	s.Reasons = append(s.Reasons, fmt.Sprintf(format, args...))
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// status 超过 staleCycles 个检查周期没有完成检查时, 认为检查已经卡住
+// ready 为 true 时, 还需要最近有成功的检查, 数据源可以访问, 并且配置了 target
+func (p *Processor) status(ctx context.Context, ready bool, staleCycles int64) *jobStatus {
+	c := p.cycles.get()
+
+	s := &jobStatus{
+		Job:         p.conf.Name,
+		OK:          true,
+		LastRun:     timePtr(c.lastRun),
+		LastFinish:  timePtr(c.lastFinish),
+		LastSuccess: timePtr(c.lastSuccess),
+		LastError:   c.lastError,
+		Channels:    make(map[string][]string),
+	}
+	now := time.Now()
+	stale := time.Duration(staleCycles*p.conf.CheckInterval) * time.Second
+
+	// 还没有完成过检查时, 从启动时开始计算
+	finish := c.lastFinish
+	if finish.IsZero() {
+		finish = c.started
+	}
+	if now.Sub(finish) > stale {
+		s.fail("no cycle finished in %s", stale)
+	}
+
+	total := 0
+	for name, c := range p.router.channels {
+		s.Channels[name] = c.Targets()
+		total += len(s.Channels[name])
+	}
+	if !ready {
+		return s
+	}
+
+	switch {
+	case c.lastSuccess.IsZero():
+		s.fail("no successful cycle yet")
+	case now.Sub(c.lastSuccess) > stale:
+		s.fail("no successful cycle in %s", stale)
+	}
+
+	if pinger, ok := p.producer.(source.Pinger); ok {
+		s.Source = &sourceStatus{Type: p.conf.GetSourceType(), Reachable: true}
+		err := pinger.Ping(ctx)
+		if err != nil {
+			s.Source.Reachable = false
+			s.Source.Error = err.Error()
+			s.fail("source %s is unreachable", s.Source.Type)
+		}
+	}
+
+	if total == 0 {
+		s.fail("no target configured")
+	}
+	return s
+}
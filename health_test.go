@@ -0,0 +1,81 @@
+package flr
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+)
+
+// pingSource 只用于检查 ready 状态, 不返回日志
+type pingSource struct {
+	err error
+}
+
+func (*pingSource) GetMessageByRange(int64, int64) ([]json.RawMessage, bool, error) {
+	return nil, false, nil
+}
+
+func (s *pingSource) Ping(context.Context) error {
+	return s.err
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		state   cycleState
+		pingErr error
+		healthy bool
+		ready   bool
+	}{
+		{"just started", cycleState{started: now}, nil, true, false},
+		{"stuck since start", cycleState{started: now.Add(-time.Hour)}, nil, false, false},
+		{"running", cycleState{started: now.Add(-time.Hour), lastFinish: now, lastSuccess: now}, nil, true, true},
+		{"failing", cycleState{started: now.Add(-time.Hour), lastFinish: now, lastSuccess: now.Add(-time.Hour), lastError: "boom"}, nil, true, false},
+		{"stuck", cycleState{started: now.Add(-time.Hour), lastFinish: now.Add(-time.Hour), lastSuccess: now.Add(-time.Hour)}, nil, false, false},
+		{"source unreachable", cycleState{started: now.Add(-time.Hour), lastFinish: now, lastSuccess: now}, errors.New("refused"), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := new(config.Job)
+			conf.CheckInterval = 10
+			p, _ := newTestProcessor(t, conf)
+			p.producer = &pingSource{err: tt.pingErr}
+			p.cycles.cycleState = tt.state
+
+			// 3 个检查周期, 即 30s 没有完成检查时视为卡住
+			if s := p.status(context.Background(), false, 3); s.OK != tt.healthy {
+				t.Fatalf("healthy = %v, want %v: %v", s.OK, tt.healthy, s.Reasons)
+			}
+			s := p.status(context.Background(), true, 3)
+			if s.OK != tt.ready {
+				t.Fatalf("ready = %v, want %v: %v", s.OK, tt.ready, s.Reasons)
+			}
+			if tt.pingErr != nil && (s.Source == nil || s.Source.Reachable) {
+				t.Fatalf("source = %+v, want unreachable", s.Source)
+			}
+		})
+	}
+}
+
+func TestStatusNoTarget(t *testing.T) {
+	conf := new(config.Job)
+	conf.CheckInterval = 10
+	p, _ := newTestProcessor(t, conf)
+	conf.Targets.Webhook.Enable = false
+	var err error
+	p.router, err = newRouter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.cycles.lastFinish = time.Now()
+	p.cycles.lastSuccess = p.cycles.lastFinish
+	if s := p.status(context.Background(), true, 3); s.OK {
+		t.Fatal("job without target should not be ready")
+	}
+}
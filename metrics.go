@@ -0,0 +1,67 @@
+package flr
+
+import (
+	"github.com/LukeEuler/funnel/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "flr_source_query_duration_seconds",
+		Help:    "Duration of queries to the log source.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"job"})
+	documentsFetched = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "flr_source_documents_fetched",
+		Help:    "Documents fetched from the log source per cycle, groups in aggregation mode.",
+		Buckets: []float64{0, 10, 100, 1000, 10000, 100000},
+	}, []string{"job"})
+	ruleEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flr_rule_events",
+		Help: "Events drawn by each rule in the last cycle.",
+	}, []string{"job", "rule"})
+	validEventsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flr_valid_events",
+		Help: "Valid events in the last cycle, logs of valid groups in aggregation mode.",
+	}, []string{"job"})
+	groupsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flr_groups",
+		Help: "Alerting groups in the last cycle, silenced groups excluded.",
+	}, []string{"job"})
+	notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flr_notifications_total",
+		Help: "Notifications by channel, target and outcome.",
+	}, []string{"job", "channel", "target", "outcome"})
+	notificationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "flr_notification_duration_seconds",
+		Help:    "Duration of notification requests.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"job", "channel", "target"})
+	cyclesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flr_cycles_total",
+		Help: "Check cycles by result.",
+	}, []string{"job", "result"})
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flr_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful check cycle.",
+	}, []string{"job"})
+)
+
+// observeEvents 统计每个规则匹配到的事件数量, 没有匹配到的规则为 0
+func (p *Processor) observeEvents(events []model.Event) {
+	counts := make(map[string]int)
+	for id := range p.conf.Rules {
+		counts[id] = 0
+	}
+	for _, item := range events {
+		info := eventRule(item)
+		if info == nil || info.RuleInfo == nil {
+			continue
+		}
+		counts[info.ID]++
+	}
+	for id, count := range counts {
+		ruleEvents.WithLabelValues(p.conf.Name, id).Set(float64(count))
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"sort"
 	"strings"
 	"time"
 
@@ -16,15 +15,24 @@ import (
 
 	"github.com/LukeEuler/funnel-log-reporter/config"
 	"github.com/LukeEuler/funnel-log-reporter/consumer"
-	"github.com/LukeEuler/funnel-log-reporter/es"
 	"github.com/LukeEuler/funnel-log-reporter/log"
+	"github.com/LukeEuler/funnel-log-reporter/source"
+	"github.com/LukeEuler/funnel-log-reporter/state"
 )
 
 const minDuration time.Duration = -1 << 63
 
 type Processor struct {
-	producer *es.Client
-	consumer *consumer.Consumer
+	conf     *config.Job
+	producer source.Source
+	router   *router
+	store    state.Store
+	silences *silencer
+	cycles   *cycles
+	// 最近一次检查中仍在报警的分组, 用于管理接口
+	active *activeGroups
+	// 管理接口触发的立即检查
+	trigger chan struct{}
 
 	lastLogs    int
 	lastWhisper time.Time // show every day when no alers
@@ -35,36 +43,134 @@ type Processor struct {
 
 	// do not alert when no new event in every group
 	lastGroupEventsRecord map[string]int64
+	// 已经报警且尚未恢复的分组, key 为 group tag
+	firing map[string]*consumer.Group
+	// 持续报警的分组, key 为 group tag
+	escalations map[string]*escalation
 }
 
-func NewProcessor() (*Processor, error) {
-	conf := config.Conf
+// processorState 需要持久化的 Processor 字段
+type processorState struct {
+	LastLogs              int                        `json:"last_logs"`
+	LastWhisper           time.Time                  `json:"last_whisper"`
+	LastEventTime         int64                      `json:"last_event_time"`
+	LastMessages          []json.RawMessage          `json:"last_messages"`
+	LastGroupEventsRecord map[string]int64           `json:"last_group_events_record"`
+	Firing                map[string]*consumer.Group `json:"firing"`
+	Silences              []*Silence                 `json:"silences"`
+	Deferred              map[string]*deferred       `json:"deferred"`
+	Escalations           map[string]*escalation     `json:"escalations"`
+}
+
+func NewProcessor(conf *config.Job) (*Processor, error) {
 	p := &Processor{
+		conf:         conf,
 		lastWhisper:  time.Now(),
 		lastMessages: make([]json.RawMessage, 0),
+		firing:       make(map[string]*consumer.Group),
+		escalations:  make(map[string]*escalation),
+		store:        state.New(conf.State.Path),
+		cycles:       newCycles(),
+		active:       new(activeGroups),
+		trigger:      make(chan struct{}, 1),
 	}
 
 	var err error
-	p.producer, err = es.NewClient(conf.Es.Address, conf.Es.Username, conf.Es.Password)
+	if !conf.Es.Aggregation {
+		err = checkEventRule(conf.TimeKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.silences, err = newSilencer(conf.Silences)
 	if err != nil {
 		return nil, err
 	}
 
-	p.consumer = new(consumer.Consumer)
-	if conf.Ding.Enable {
-		p.consumer.SetDingTalk(conf.Ding.URL, conf.Ding.Secret, conf.Ding.Mobiles)
+	p.producer, err = source.New(conf)
+	if err != nil {
+		return nil, err
 	}
-	if conf.Lark.Enable {
-		p.consumer.SetLark(conf.Lark.URL, conf.Lark.Secret)
+
+	p.router, err = newRouter(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.restore()
+	if err != nil {
+		return nil, err
 	}
 
 	if conf.Hi {
-		_ = p.consumer.Send(conf.Custom.HiTitle, conf.Custom.HiColor, conf.Custom.HiContent, false)
+		_ = p.send(&consumer.Message{
+			Kind:    consumer.KindInfo,
+			Title:   conf.Custom.HiTitle,
+			Color:   conf.Custom.HiColor,
+			Content: conf.Custom.HiContent,
+		})
 	}
 
 	return p, nil
 }
 
+func newConsumer(job *config.Job, conf *config.Targets) (*consumer.Consumer, error) {
+	c := new(consumer.Consumer)
+	c.SetRateLimit(conf.RateLimit.PerMinute, conf.RateLimit.Burst)
+	c.SetRetry(conf.Retry.MaxAttempts, time.Duration(conf.Retry.MaxBackoff)*time.Second)
+	if conf.Ding.Enable {
+		c.SetDingTalk(conf.Ding.URL, conf.Ding.Secret, conf.Ding.Mobiles)
+	}
+	if conf.Lark.Enable {
+		c.SetLark(conf.Lark.URL, conf.Lark.Secret, conf.Lark.UserIDs)
+	}
+	if conf.Slack.Enable {
+		c.SetSlack(conf.Slack.URL, conf.Slack.Users, conf.Slack.Groups)
+	}
+	if conf.Email.Enable {
+		err := c.SetEmail(conf.Email.Host, conf.Email.Port, conf.Email.Username, conf.Email.Password,
+			conf.Email.TLS, conf.Email.From, conf.Email.To)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Telegram.Enable {
+		err := c.SetTelegram(conf.Telegram.Token, conf.Telegram.ChatIDs, conf.Telegram.ParseMode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Teams.Enable {
+		c.SetTeams(conf.Teams.URL)
+	}
+	if conf.Wecom.Enable {
+		c.SetWecom(conf.Wecom.URL, conf.Wecom.Mobiles)
+	}
+	if conf.PagerDuty.Enable {
+		c.SetPagerDuty(conf.PagerDuty.RoutingKey, conf.PagerDuty.Severity)
+	}
+	if conf.Alertmanager.Enable {
+		// 分组有新的日志时会重新发送报警, 否则最晚在 duration_s 之后恢复, 预留两个检查周期
+		endsAfter := time.Duration(job.Duration+2*job.CheckInterval) * time.Second
+		c.SetAlertmanager(conf.Alertmanager.URLs, conf.Alertmanager.AlertName, endsAfter)
+	}
+	if conf.Webhook.Enable {
+		err := c.SetWebhook(conf.Webhook.URL, conf.Webhook.Method, conf.Webhook.Headers, conf.Webhook.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Fallback != nil {
+		f, err := newConsumer(job, conf.Fallback)
+		if err != nil {
+			return nil, err
+		}
+		c.SetFallback(f)
+	}
+	return c, nil
+}
+
 func (p *Processor) Loop(shutdown chan struct{}) {
 	timer := time.NewTimer(minDuration)
 	for {
@@ -73,32 +179,89 @@ func (p *Processor) Loop(shutdown chan struct{}) {
 			return
 		case <-timer.C:
 			p.work()
-			timer.Reset(time.Duration(config.Conf.CheckInterval) * time.Second)
+			timer.Reset(time.Duration(p.conf.CheckInterval) * time.Second)
+		case <-p.trigger:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			p.work()
+			timer.Reset(time.Duration(p.conf.CheckInterval) * time.Second)
 		}
 	}
 }
 
+// Trigger 立即执行一次检查, 已经有等待执行的检查时返回 false
+func (p *Processor) Trigger() bool {
+	select {
+	case p.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Processor) work() {
-	conf := config.Conf
+	p.cycles.begin()
+	defer p.checkpoint()
+
+	// 发送失败的已在 record 中记录
+	results, fired := p.router.flush()
+	_ = p.record(results)
+	p.fire(fired)
+
+	var err error
+	if p.conf.Es.Aggregation {
+		err = p.workAggregation()
+	} else {
+		err = p.workEvents()
+	}
+	p.finish(err)
+}
+
+// finish 记录本轮检查的结果
+func (p *Processor) finish(err error) {
+	p.cycles.end(err)
+	if err != nil {
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+		cyclesTotal.WithLabelValues(p.conf.Name, "failure").Inc()
+		return
+	}
+	cyclesTotal.WithLabelValues(p.conf.Name, "success").Inc()
+	lastSuccess.WithLabelValues(p.conf.Name).SetToCurrentTime()
+}
+
+// workEvents 拉取日志, 由 rules 匹配出需要报警的事件
+// 只返回查询与匹配的错误, 发送失败不影响本轮检查的结果
+func (p *Processor) workEvents() error {
+	conf := p.conf
 	endTime := time.Now().UnixMilli()
 	beginTime := endTime - conf.Duration*1000
 
 	// 增量更新数据, 减少es数据查询量
+	// 从最后一条日志的时间(包含)开始查询, 上一次结果被截断时, 同一毫秒内没有获取的日志不会丢失
 	esBeginTime := beginTime
-	lastEndTime := lastValidEndTime(p.lastMessages, conf.Es.RangeTimeName)
+	lastEndTime := lastValidEndTime(p.lastMessages, conf.GetRangeTimeName())
 	if esBeginTime <= lastEndTime {
-		esBeginTime = lastEndTime + 1
+		esBeginTime = lastEndTime
 	}
 
-	newData, err := p.producer.GetMessageByRange(esBeginTime, endTime, conf.ToEsConfig())
+	begin := time.Now()
+	newData, truncated, err := p.producer.GetMessageByRange(esBeginTime, endTime)
+	queryDuration.WithLabelValues(conf.Name).Observe(time.Since(begin).Seconds())
 	if err != nil {
-		log.Entry.WithError(err).Error(err)
-		return
+		return err
+	}
+	documentsFetched.WithLabelValues(conf.Name).Observe(float64(len(newData)))
+	if esBeginTime == lastEndTime {
+		newData = dropFetched(p.lastMessages, newData, conf.GetRangeTimeName(), lastEndTime)
+	}
+	if truncated {
+		log.Entry.Warnf("[%s] too many messages, only get %d of them", conf.Name, len(newData))
 	}
 
-	p.lastMessages, err = lastValidMsg(p.lastMessages, conf.Es.RangeTimeName, beginTime)
+	p.lastMessages, err = lastValidMsg(p.lastMessages, conf.GetRangeTimeName(), beginTime)
 	if err != nil {
-		log.Entry.WithError(err).Error(err)
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
 		p.lastMessages = newData
 	} else {
 		p.lastMessages = append(p.lastMessages, newData...)
@@ -112,13 +275,13 @@ func (p *Processor) work() {
 				SetTimeKeys(conf.TimeKey...))
 	}
 
-	log.Entry.Warnf("get %d message", len(message))
+	log.Entry.Warnf("[%s] get %d message", conf.Name, len(message))
 
 	events, err := event.Draw(message, conf.GetRules())
 	if err != nil {
-		log.Entry.WithError(err).Error(err)
-		return
+		return err
 	}
+	p.observeEvents(events)
 
 	validEvents := make([]model.Event, 0, len(events))
 	for _, item := range events {
@@ -126,38 +289,16 @@ func (p *Processor) work() {
 			validEvents = append(validEvents, item)
 		}
 	}
+	validEventsGauge.WithLabelValues(conf.Name).Set(float64(len(validEvents)))
 
 	length := len(validEvents)
 	if length == 0 {
-		if p.lastLogs == 0 {
-			if time.Since(p.lastWhisper) > 24*time.Hour {
-				err = p.consumer.Send(
-					conf.Custom.HeartbeatTitle,
-					conf.Custom.HeartbeatTitleColor,
-					conf.Custom.HeartbeatTitleContent,
-					false)
-				if err != nil {
-					log.Entry.WithError(err).Error(err)
-				}
-				p.lastWhisper = time.Now()
-			}
-			return
-		}
-		p.lastLogs = 0
-		p.lastWhisper = time.Now()
-
-		err = p.consumer.Send(
-			conf.Custom.RecoverTitle,
-			conf.Custom.RecoverColor,
-			fmt.Sprintf("tips: %s", conf.GetBaseQueryTimeInfo()),
-			false)
-		if err != nil {
-			log.Entry.WithError(err).Error(err)
-		}
-		return
+		groupsGauge.WithLabelValues(conf.Name).Set(0)
+		p.noEvent()
+		return nil
 	}
 
-	log.Entry.Warnf("%d needs report", len(validEvents))
+	log.Entry.Warnf("[%s] %d needs report", conf.Name, len(validEvents))
 	duration := time.Duration(conf.Duration) * time.Second
 	interval := time.Duration(conf.CheckInterval) * time.Second
 	title := fmt.Sprintf("错误: %d/%d(有效/总数) in %s. interval %s",
@@ -171,68 +312,203 @@ func (p *Processor) work() {
 		}
 	}
 
+	groups, silenced, groupEventsRecord := p.groupLogs(validEvents, conf.GroupKeys, conf.ShowKeys)
+	groupsGauge.WithLabelValues(conf.Name).Set(float64(len(groups)))
+	// 没有新日志时也需要检查是否升级, 在本轮报警之后执行
+	defer p.escalate(groups)
+	p.resolve(groups)
+
 	if !change {
-		return
+		return nil
 	}
-
-	content, ok := p.groupLogs(validEvents, conf.GroupKeys, conf.ShowKeys)
-	if !ok {
-		return
+	if !p.checkAndReplaceGroupLogsRecord(groupEventsRecord) {
+		return nil
 	}
-	err = p.consumer.Send(title, conf.Custom.AlertColor, content, true)
+	footer := silencedFooter(silenced)
+	if truncated {
+		title += " (truncated)"
+		footer = joinLines(footer, "注意: 日志数量超过单次查询上限, 本次结果已截断")
+	}
+	// 发送失败的 target 已写入 outbox 等待重试, 只记录错误
+	err = p.sendAlert(title, groups, footer)
 	if err != nil {
-		log.Entry.WithError(err).Error(err)
-		return
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
 	}
 
 	p.lastLogs = length
+	p.fire(groups)
+	return nil
 }
 
-const (
-	sep = "__"
-)
+// noEvent 没有需要报警的日志时, 发送恢复或者心跳消息
+func (p *Processor) noEvent() {
+	conf := p.conf
+	p.setActive(nil)
+	defer p.router.prune(nil)
+	if p.lastLogs == 0 {
+		if time.Since(p.lastWhisper) > 24*time.Hour {
+			err := p.send(&consumer.Message{
+				Kind:    consumer.KindInfo,
+				Title:   conf.Custom.HeartbeatTitle,
+				Color:   conf.Custom.HeartbeatTitleColor,
+				Content: conf.Custom.HeartbeatTitleContent,
+			})
+			if err != nil {
+				log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+			}
+			p.lastWhisper = time.Now()
+		}
+		return
+	}
+	p.lastLogs = 0
+	p.lastWhisper = time.Now()
+	p.escalations = make(map[string]*escalation)
 
-func (p *Processor) groupLogs(events []model.Event, groupKeys [][]string, showKeys []string) (string, bool) {
-	groupEventsRecord, collection := handleEvents(events, groupKeys)
+	err := p.sendRecover(conf.Custom.RecoverTitle, p.firingGroups())
+	if err != nil {
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+	}
+	p.firing = make(map[string]*consumer.Group)
+}
 
-	ok := p.checkAndReplaceGroupLogsRecord(groupEventsRecord)
+func (p *Processor) send(msg *consumer.Message) error {
+	msg.Job = p.conf.Name
+	return p.record(p.router.send(msg))
+}
+
+func (p *Processor) restore() error {
+	err := p.router.restoreOutbox()
+	if err != nil {
+		return err
+	}
+
+	st := new(processorState)
+	ok, err := p.store.Load(st)
+	if err != nil {
+		return err
+	}
 	if !ok {
-		return "", false
+		return nil
 	}
 
-	type tempRecord struct {
-		groupTag string
-		lastTime int64
+	p.lastLogs = st.LastLogs
+	if !st.LastWhisper.IsZero() {
+		p.lastWhisper = st.LastWhisper
 	}
-	sortList := make([]tempRecord, 0, len(groupEventsRecord))
-	for groupTag, lastTime := range groupEventsRecord {
-		sortList = append(sortList, tempRecord{groupTag, lastTime})
+	p.lastEventTime = st.LastEventTime
+	if st.LastMessages != nil {
+		p.lastMessages = st.LastMessages
+	}
+	p.lastGroupEventsRecord = st.LastGroupEventsRecord
+	for key, item := range st.Firing {
+		p.firing[key] = item
 	}
-	sort.SliceStable(sortList, func(i, j int) bool {
-		return sortList[i].lastTime < sortList[j].lastTime
+	p.silences.restore(st.Silences)
+	for key, item := range st.Deferred {
+		p.router.deferred[key] = item
+	}
+	for key, item := range st.Escalations {
+		p.escalations[key] = item
+	}
+	log.Entry.Infof("[%s] restore state: %d messages, last event time %d", p.conf.Name, len(p.lastMessages), p.lastEventTime)
+	return nil
+}
+
+func (p *Processor) checkpoint() {
+	err := p.store.Save(&processorState{
+		LastLogs:              p.lastLogs,
+		LastWhisper:           p.lastWhisper,
+		LastEventTime:         p.lastEventTime,
+		LastMessages:          p.lastMessages,
+		LastGroupEventsRecord: p.lastGroupEventsRecord,
+		Firing:                p.firing,
+		Silences:              p.silences.all(),
+		Deferred:              p.router.deferred,
+		Escalations:           p.escalations,
 	})
+	if err != nil {
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+	}
+}
 
-	buffer := bytes.NewBufferString("")
+const (
+	sep = "__"
+)
 
-	for idx, item := range sortList {
-		groupTag := item.groupTag
+// groupLogs 返回需要报警的分组, 被屏蔽的分组数量, 以及未被屏蔽分组的最新日志时间
+func (p *Processor) groupLogs(events []model.Event, groupKeys [][]string, showKeys []string) ([]*consumer.Group, int, map[string]int64) {
+	groupEventsRecord, collection := handleEvents(events, groupKeys)
+
+	keys := groupKeyNames(groupKeys)
+	groups := make([]*consumer.Group, 0, len(groupEventsRecord))
+	silenced := 0
+	for groupTag, lastTime := range groupEventsRecord {
 		list := collection[groupTag]
 		length := len(list)
-		tagList := strings.Split(groupTag, sep)
-		if idx > 0 {
-			buffer.WriteString("\n")
+		group := newGroup(groupTag, length, lastTime, showKeys, list[length-1].GetValueString)
+		group.Keys = keys
+		setGroupRule(group, list)
+		if p.silences.silenced(group, list[length-1].GetValueString) {
+			// 已报警的分组仍保留在 firing 中, 由 resolve 发送恢复, 关闭 pagerduty, alertmanager 中的报警
+			delete(groupEventsRecord, groupTag)
+			silenced++
+			continue
 		}
-		buffer.WriteString(fmt.Sprintf("%v errors %d\n", tagList, length))
-		for _, key := range showKeys {
-			value, ok := list[length-1].GetValueString(key)
-			if ok {
-				buffer.WriteString(fmt.Sprintf("%s: %s\n", key, strings.TrimSpace(value)))
-			} else {
-				buffer.WriteString(fmt.Sprintf("%s -\n", key))
+		p.accumulate(group, func(prev *consumer.Group) int {
+			fresh := 0
+			for _, item := range list {
+				if item.GetTime() > prev.LastTime {
+					fresh++
+				}
 			}
+			return fresh
+		})
+		groups = append(groups, group)
+	}
+
+	sortGroups(groups)
+	return groups, silenced, groupEventsRecord
+}
+
+func newGroup(groupTag string, count int, lastTime int64, showKeys []string,
+	getValue func(key string) (string, bool)) *consumer.Group {
+	group := &consumer.Group{
+		Tag:      groupTag,
+		Values:   strings.Split(groupTag, sep),
+		Count:    count,
+		LastTime: lastTime,
+		Fields:   make([]*consumer.Field, 0, len(showKeys)),
+	}
+	for _, key := range showKeys {
+		value, ok := getValue(key)
+		group.Fields = append(group.Fields, &consumer.Field{
+			Key:     key,
+			Value:   value,
+			Missing: !ok,
+		})
+	}
+	return group
+}
+
+func joinLines(lines ...string) string {
+	list := make([]string, 0, len(lines))
+	for _, item := range lines {
+		if len(item) > 0 {
+			list = append(list, item)
 		}
 	}
-	return buffer.String(), true
+	return strings.Join(list, "\n")
+}
+
+func alertContent(groups []*consumer.Group, footer string) string {
+	list := make([]string, 0, len(groups)+1)
+	for _, item := range groups {
+		list = append(list, item.String())
+	}
+	if len(footer) > 0 {
+		list = append(list, footer)
+	}
+	return strings.Join(list, "\n")
 }
 
 func handleEvents(events []model.Event, groupKeys [][]string) (map[string]int64, map[string][]model.Event) {
@@ -300,9 +576,12 @@ func lastValidEndTime(lastMessages []json.RawMessage, timeKey string) int64 {
 	if len(lastMessages) == 0 {
 		return 0
 	}
-	message := lastMessages[len(lastMessages)-1]
+	return messageTime(lastMessages[len(lastMessages)-1], timeKey)
+}
+
+// messageTime 无法解析时返回 0
+func messageTime(message json.RawMessage, timeKey string) int64 {
 	value := gjson.GetBytes(message, timeKey)
-	var t time.Time
 	t, err := time.Parse(time.RFC3339Nano, value.String())
 	if err != nil {
 		return 0
@@ -310,6 +589,41 @@ func lastValidEndTime(lastMessages []json.RawMessage, timeKey string) int64 {
 	return t.UnixMilli()
 }
 
+// dropFetched 去掉 newData 中已经获取过的, 时间为 lastEnd 的日志
+// 同一毫秒内的日志数量超过 max_docs 时, 无法继续向后获取
+func dropFetched(lastMessages, newData []json.RawMessage, timeKey string, lastEnd int64) []json.RawMessage {
+	// 状态文件中保存的日志已经被压缩, 比较前统一压缩
+	compact := func(message json.RawMessage) string {
+		buffer := new(bytes.Buffer)
+		if json.Compact(buffer, message) != nil {
+			return string(message)
+		}
+		return buffer.String()
+	}
+
+	fetched := make(map[string]int)
+	for idx := len(lastMessages) - 1; idx >= 0; idx-- {
+		if messageTime(lastMessages[idx], timeKey) != lastEnd {
+			break
+		}
+		fetched[compact(lastMessages[idx])]++
+	}
+	if len(fetched) == 0 {
+		return newData
+	}
+
+	result := make([]json.RawMessage, 0, len(newData))
+	for _, item := range newData {
+		key := compact(item)
+		if fetched[key] > 0 {
+			fetched[key]--
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
 func lastValidMsg(lastMessages []json.RawMessage, timeKey string, begin int64) ([]json.RawMessage, error) {
 	if len(lastMessages) == 0 {
 		return []json.RawMessage{}, nil
@@ -0,0 +1,143 @@
+package flr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/state"
+)
+
+// webhookRecorder 记录 webhook target 收到的通知
+type webhookRecorder struct {
+	mu       sync.Mutex
+	messages []*consumer.Message
+}
+
+func (w *webhookRecorder) all() []*consumer.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*consumer.Message{}, w.messages...)
+}
+
+// newTestProcessor 不连接数据源, 通知发送到本地的 webhook
+func newTestProcessor(t *testing.T, conf *config.Job) (*Processor, *webhookRecorder) {
+	recorder := new(webhookRecorder)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := new(consumer.Message)
+		if err := json.NewDecoder(r.Body).Decode(msg); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		recorder.mu.Lock()
+		recorder.messages = append(recorder.messages, msg)
+		recorder.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	if len(conf.Name) == 0 {
+		conf.Name = "test"
+	}
+	conf.Targets.Webhook.Enable = true
+	conf.Targets.Webhook.URL = server.URL
+
+	p := &Processor{
+		conf:         conf,
+		lastWhisper:  time.Now(),
+		lastMessages: make([]json.RawMessage, 0),
+		firing:       make(map[string]*consumer.Group),
+		escalations:  make(map[string]*escalation),
+		store:        state.New(conf.State.Path),
+		cycles:       newCycles(),
+		active:       new(activeGroups),
+		trigger:      make(chan struct{}, 1),
+	}
+	var err error
+	p.silences, err = newSilencer(conf.Silences)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.router, err = newRouter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, recorder
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	conf := new(config.Job)
+	conf.State.Path = path
+	p, _ := newTestProcessor(t, conf)
+	p.lastLogs = 2
+	p.lastEventTime = 1000
+	p.lastMessages = []json.RawMessage{json.RawMessage(`{"time":"2024-01-01T00:00:00Z"}`)}
+	p.lastGroupEventsRecord = map[string]int64{"a": 1000}
+	p.firing["a"] = &consumer.Group{Tag: "a", Values: []string{"a"}, Count: 2, Since: 500}
+	p.escalations["a"] = &escalation{Since: time.UnixMilli(500).UTC(), Cycles: 3, Tier: 1}
+	p.router.deferred["default/-1"] = &deferred{Channel: "default", Route: -1, Alerts: 1, Groups: []*consumer.Group{{Tag: "b"}}}
+	silence, err := p.silences.add(&Silence{Match: map[string]string{"a": "a"}, Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.checkpoint()
+
+	restoredConf := new(config.Job)
+	restoredConf.State.Path = path
+	restored, _ := newTestProcessor(t, restoredConf)
+	if err = restored.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.lastLogs != 2 || restored.lastEventTime != 1000 || len(restored.lastMessages) != 1 {
+		t.Fatalf("restored = %+v", restored)
+	}
+	if !reflect.DeepEqual(restored.lastGroupEventsRecord, p.lastGroupEventsRecord) {
+		t.Fatalf("group events record = %v, want %v", restored.lastGroupEventsRecord, p.lastGroupEventsRecord)
+	}
+	if !reflect.DeepEqual(restored.firing, p.firing) {
+		t.Fatalf("firing = %+v, want %+v", restored.firing, p.firing)
+	}
+	if !reflect.DeepEqual(restored.escalations, p.escalations) {
+		t.Fatalf("escalations = %+v, want %+v", restored.escalations, p.escalations)
+	}
+	if d := restored.router.deferred["default/-1"]; d == nil || len(d.Groups) != 1 || d.Groups[0].Tag != "b" {
+		t.Fatalf("deferred = %+v", restored.router.deferred)
+	}
+	if list := restored.silences.all(); len(list) != 1 || list[0].ID != silence.ID {
+		t.Fatalf("silences = %+v, want %s", list, silence.ID)
+	}
+}
+
+func TestDropFetched(t *testing.T) {
+	raw := func(list ...string) []json.RawMessage {
+		result := make([]json.RawMessage, 0, len(list))
+		for _, item := range list {
+			result = append(result, json.RawMessage(item))
+		}
+		return result
+	}
+	last := raw(
+		`{"time":"2024-01-01T00:00:00.001Z","id":1}`,
+		`{"time":"2024-01-01T00:00:00.002Z","id":2}`,
+		`{"time":"2024-01-01T00:00:00.002Z","id":3}`,
+	)
+	lastEnd := lastValidEndTime(last, "time")
+
+	// 上一次被截断, id 4 与 id 2, 3 在同一毫秒
+	newData := raw(
+		`{"time": "2024-01-01T00:00:00.002Z", "id": 2}`,
+		`{"time":"2024-01-01T00:00:00.002Z","id":3}`,
+		`{"time":"2024-01-01T00:00:00.002Z","id":4}`,
+		`{"time":"2024-01-01T00:00:00.003Z","id":5}`,
+	)
+	got := dropFetched(last, newData, "time", lastEnd)
+	if len(got) != 2 || string(got[0]) != string(newData[2]) || string(got[1]) != string(newData[3]) {
+		t.Fatalf("dropFetched() = %s, want id 4 and 5", got)
+	}
+}
@@ -0,0 +1,205 @@
+package flr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// quietSchedule 静默时段内, 非紧急的报警会被缓存, 静默结束后汇总发送
+type quietSchedule struct {
+	location    *time.Location
+	bypassLevel int
+	windows     []*quietWindow
+}
+
+type quietWindow struct {
+	weekdays   map[time.Weekday]bool // 为空时表示每天
+	start, end int                   // 一天中的分钟数, start > end 时跨越午夜
+}
+
+// newQuietSchedule 没有配置时返回 nil
+func newQuietSchedule(conf *config.QuietHours) (*quietSchedule, error) {
+	if conf == nil || len(conf.Windows) == 0 {
+		return nil, nil
+	}
+	location := time.Local
+	if len(conf.Timezone) > 0 {
+		var err error
+		location, err = time.LoadLocation(conf.Timezone)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	q := &quietSchedule{
+		location:    location,
+		bypassLevel: conf.BypassLevel,
+	}
+	for idx, item := range conf.Windows {
+		w := &quietWindow{weekdays: make(map[time.Weekday]bool)}
+		for _, day := range item.Weekdays {
+			weekday, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+			if !ok {
+				return nil, errors.Errorf("unknown weekday %s in quiet windows[%d]", day, idx)
+			}
+			w.weekdays[weekday] = true
+		}
+		var err error
+		w.start, err = parseClock(item.Start)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "quiet windows[%d]", idx)
+		}
+		w.end, err = parseClock(item.End)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "quiet windows[%d]", idx)
+		}
+		q.windows = append(q.windows, w)
+	}
+	return q, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("can not parse %s as hh:mm", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (q *quietSchedule) active(now time.Time) bool {
+	if q == nil {
+		return false
+	}
+	t := now.In(q.location)
+	minutes := t.Hour()*60 + t.Minute()
+	for _, w := range q.windows {
+		if w.contains(t.Weekday(), minutes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *quietWindow) contains(weekday time.Weekday, minutes int) bool {
+	on := func(day time.Weekday) bool {
+		return len(w.weekdays) == 0 || w.weekdays[day]
+	}
+	switch {
+	case w.start == w.end:
+		return on(weekday)
+	case w.start < w.end:
+		return on(weekday) && minutes >= w.start && minutes < w.end
+	default:
+		// 跨越午夜时, 凌晨部分属于前一天的静默时段
+		if minutes >= w.start {
+			return on(weekday)
+		}
+		return minutes < w.end && on((weekday+6)%7)
+	}
+}
+
+// bypass level <= bypass_level 的分组不受静默影响
+// 没有规则信息的分组(聚合模式, 或者日志没有命中规则)视为非紧急
+func (q *quietSchedule) bypass(group *consumer.Group) bool {
+	return len(group.RuleID) > 0 && group.Level <= q.bypassLevel
+}
+
+// deferred 静默期间缓存的报警, 按 channel 与 route 区分
+type deferred struct {
+	Channel string            `json:"channel"`
+	Route   int               `json:"route"` // routes 的下标, -1 表示使用 job 的静默配置
+	Since   time.Time         `json:"since"`
+	Alerts  int               `json:"alerts"`
+	Groups  []*consumer.Group `json:"groups"`
+}
+
+func deferredKey(channel string, route int) string {
+	return fmt.Sprintf("%s/%d", channel, route)
+}
+
+// add 同一个分组只保留最新的记录
+func (d *deferred) add(groups []*consumer.Group) {
+	d.Alerts++
+	for _, group := range groups {
+		found := false
+		for idx, item := range d.Groups {
+			if item.Tag == group.Tag {
+				d.Groups[idx] = group
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.Groups = append(d.Groups, group)
+		}
+	}
+}
+
+// remove 删除分组, 返回是否存在
+func (d *deferred) remove(tag string) bool {
+	for idx, item := range d.Groups {
+		if item.Tag == tag {
+			d.Groups = append(d.Groups[:idx], d.Groups[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// undefer 分组已恢复, 从 channel 的缓存中删除, 返回是否存在
+// 存在时说明报警还没有发送到该 channel, 也不需要发送恢复
+func (r *router) undefer(channel, tag string) bool {
+	found := false
+	for key, d := range r.deferred {
+		if d.Channel != channel || !d.remove(tag) {
+			continue
+		}
+		found = true
+		if len(d.Groups) == 0 {
+			delete(r.deferred, key)
+		}
+	}
+	return found
+}
+
+// prune 删除缓存中已经恢复的分组, current 为本轮仍在报警的分组
+// 这些分组的报警还没有发送, 因此也不会发送恢复
+func (r *router) prune(current map[string]bool) {
+	for key, d := range r.deferred {
+		groups := make([]*consumer.Group, 0, len(d.Groups))
+		for _, group := range d.Groups {
+			if current[group.Tag] {
+				groups = append(groups, group)
+			}
+		}
+		d.Groups = groups
+		if len(groups) == 0 {
+			delete(r.deferred, key)
+		}
+	}
+	for tag := range r.held {
+		if !current[tag] {
+			delete(r.held, tag)
+		}
+	}
+	for tag := range r.undelivered {
+		if !current[tag] {
+			delete(r.undelivered, tag)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package flr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+func TestQuietWindowContains(t *testing.T) {
+	clock := func(s string) int {
+		minutes, err := parseClock(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return minutes
+	}
+	tests := []struct {
+		name     string
+		window   *config.QuietWindow
+		weekday  time.Weekday
+		clock    string
+		contains bool
+	}{
+		{"all day", &config.QuietWindow{Start: "00:00", End: "00:00"}, time.Monday, "12:00", true},
+		{"all weekend", &config.QuietWindow{Weekdays: []string{"sat", "sun"}, Start: "00:00", End: "00:00"}, time.Sunday, "23:59", true},
+		{"not weekend", &config.QuietWindow{Weekdays: []string{"sat", "sun"}, Start: "00:00", End: "00:00"}, time.Monday, "00:00", false},
+		{"before start", &config.QuietWindow{Start: "09:00", End: "18:00"}, time.Monday, "08:59", false},
+		{"at start", &config.QuietWindow{Start: "09:00", End: "18:00"}, time.Monday, "09:00", true},
+		{"before end", &config.QuietWindow{Start: "09:00", End: "18:00"}, time.Monday, "17:59", true},
+		{"at end", &config.QuietWindow{Start: "09:00", End: "18:00"}, time.Monday, "18:00", false},
+		{"overnight evening", &config.QuietWindow{Weekdays: []string{"fri"}, Start: "22:00", End: "08:00"}, time.Friday, "23:00", true},
+		{"overnight morning", &config.QuietWindow{Weekdays: []string{"fri"}, Start: "22:00", End: "08:00"}, time.Saturday, "07:59", true},
+		{"overnight previous day", &config.QuietWindow{Weekdays: []string{"fri"}, Start: "22:00", End: "08:00"}, time.Friday, "07:00", false},
+		{"overnight other evening", &config.QuietWindow{Weekdays: []string{"fri"}, Start: "22:00", End: "08:00"}, time.Saturday, "23:00", false},
+		{"overnight daytime", &config.QuietWindow{Start: "22:00", End: "08:00"}, time.Monday, "12:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := newQuietSchedule(&config.QuietHours{Windows: []*config.QuietWindow{tt.window}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.windows[0].contains(tt.weekday, clock(tt.clock)); got != tt.contains {
+				t.Fatalf("contains(%s, %s) = %v, want %v", tt.weekday, tt.clock, got, tt.contains)
+			}
+		})
+	}
+}
+
+func TestNewQuietSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.QuietHours
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"weekday", &config.QuietHours{Windows: []*config.QuietWindow{{Weekdays: []string{"Monday"}, Start: "00:00", End: "01:00"}}}, false},
+		{"bad weekday", &config.QuietHours{Windows: []*config.QuietWindow{{Weekdays: []string{"xyz"}, Start: "00:00", End: "01:00"}}}, true},
+		{"bad clock", &config.QuietHours{Windows: []*config.QuietWindow{{Start: "25:00", End: "01:00"}}}, true},
+		{"bad timezone", &config.QuietHours{Timezone: "Mars/Olympus", Windows: []*config.QuietWindow{{Start: "00:00", End: "01:00"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newQuietSchedule(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newQuietSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouterDeferredRecovery(t *testing.T) {
+	conf := &config.Job{Name: "test", Quiet: &config.QuietHours{
+		BypassLevel: -1,
+		Windows:     []*config.QuietWindow{{Start: "00:00", End: "00:00"}},
+	}}
+	r, err := newRouter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.send(&consumer.Message{Kind: consumer.KindAlert, Groups: []*consumer.Group{{Tag: "a"}, {Tag: "b"}}})
+	if !r.held["a"] || !r.held["b"] || len(r.deferred) != 1 {
+		t.Fatalf("held = %v, deferred = %v, want both groups held", r.held, r.deferred)
+	}
+
+	// 报警还没有发送, 恢复也不发送, 并从缓存中删除
+	results := r.send(&consumer.Message{Kind: consumer.KindRecover, Resolved: []*consumer.Group{{Tag: "a"}}})
+	if len(results) != 0 {
+		t.Fatalf("recover results = %+v, want none", results)
+	}
+	groups := r.deferred[deferredKey(config.DefaultChannel, -1)].Groups
+	if len(groups) != 1 || groups[0].Tag != "b" {
+		t.Fatalf("deferred groups = %+v, want [b]", groups)
+	}
+
+	r.prune(map[string]bool{})
+	if len(r.deferred) != 0 || len(r.held) != 0 {
+		t.Fatalf("held = %v, deferred = %v, want empty after prune", r.held, r.deferred)
+	}
+}
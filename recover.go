@@ -0,0 +1,116 @@
+package flr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+)
+
+// accumulate 继承分组在报警期间的累计信息
+// fresh 返回上一轮之后新增的日志数量
+func (p *Processor) accumulate(group *consumer.Group, fresh func(prev *consumer.Group) int) {
+	prev, ok := p.firing[group.Tag]
+	if !ok {
+		group.Total = group.Count
+		return
+	}
+	group.Since = prev.Since
+	group.Total = prev.Total + fresh(prev)
+}
+
+// fire 记录已经报警的分组, 用于分组恢复时通知
+// 只被静默时段缓存的分组, 在汇总发送时才记录
+func (p *Processor) fire(groups []*consumer.Group) {
+	now := time.Now().UnixMilli()
+	for _, item := range groups {
+		if p.router.held[item.Tag] || p.router.undelivered[item.Tag] {
+			continue
+		}
+		if item.Since == 0 {
+			item.Since = now
+		}
+		p.firing[item.Tag] = item
+	}
+}
+
+// resolve 部分分组恢复, 其余分组仍在报警时, 只通知已恢复的分组
+// groups 为本轮仍在报警的分组
+func (p *Processor) resolve(groups []*consumer.Group) {
+	current := make(map[string]bool, len(groups))
+	for _, item := range groups {
+		current[item.Tag] = true
+		if _, ok := p.firing[item.Tag]; ok {
+			p.firing[item.Tag] = item
+		}
+	}
+
+	// 在恢复消息发送之后执行, 发送时需要区分分组在每个 channel 中是否被缓存
+	defer p.router.prune(current)
+
+	resolved := make([]*consumer.Group, 0)
+	for tag, item := range p.firing {
+		if !current[tag] {
+			resolved = append(resolved, item)
+			delete(p.firing, tag)
+		}
+	}
+	if len(resolved) == 0 {
+		return
+	}
+	sortGroups(resolved)
+
+	title := fmt.Sprintf("%s: %d 个分组已恢复, %d 个分组仍在报警",
+		p.conf.Custom.RecoverTitle, len(resolved), len(groups))
+	err := p.sendRecover(title, resolved)
+	if err != nil {
+		log.Entry.WithError(err).WithField("job", p.conf.Name).Error(err)
+	}
+}
+
+func (p *Processor) firingGroups() []*consumer.Group {
+	groups := make([]*consumer.Group, 0, len(p.firing))
+	for _, item := range p.firing {
+		groups = append(groups, item)
+	}
+	sortGroups(groups)
+	return groups
+}
+
+func (p *Processor) sendRecover(title string, groups []*consumer.Group) error {
+	footer := fmt.Sprintf("tips: %s", p.conf.GetBaseQueryTimeInfo())
+	return p.send(&consumer.Message{
+		Kind:     consumer.KindRecover,
+		Title:    title,
+		Color:    p.conf.Custom.RecoverColor,
+		Content:  recoverContent(groups, footer),
+		Footer:   footer,
+		Resolved: groups,
+	})
+}
+
+// recoverContent 已恢复分组的报警时长与日志总数
+func recoverContent(groups []*consumer.Group, footer string) string {
+	now := time.Now()
+	list := make([]string, 0, len(groups)+1)
+	for _, item := range groups {
+		line := fmt.Sprintf("%v errors %d", item.Values, item.Total)
+		if item.Since > 0 {
+			line += fmt.Sprintf(", 持续 %s", now.Sub(time.UnixMilli(item.Since)).Truncate(time.Second))
+		}
+		list = append(list, line)
+	}
+	if len(footer) > 0 {
+		list = append(list, footer)
+	}
+	return strings.Join(list, "\n")
+}
+
+func sortGroups(groups []*consumer.Group) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].LastTime < groups[j].LastTime
+	})
+}
@@ -0,0 +1,46 @@
+package flr
+
+import (
+	"testing"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+func TestResolve(t *testing.T) {
+	p, recorder := newTestProcessor(t, new(config.Job))
+	p.fire([]*consumer.Group{
+		{Tag: "a", Values: []string{"a"}, Count: 1, Total: 1},
+		{Tag: "b", Values: []string{"b"}, Count: 1, Total: 1},
+		{Tag: "c", Values: []string{"c"}, Count: 1, Total: 1},
+	})
+
+	// b 仍在报警, 只通知 a, c 已恢复
+	current := &consumer.Group{Tag: "b", Values: []string{"b"}, Count: 2}
+	p.accumulate(current, func(prev *consumer.Group) int { return current.Count })
+	p.resolve([]*consumer.Group{current})
+	messages := recorder.all()
+	if len(messages) != 1 || messages[0].Kind != consumer.KindRecover {
+		t.Fatalf("messages = %+v, want one recover message", messages)
+	}
+	resolved := messages[0].Resolved
+	tags := map[string]bool{}
+	for _, item := range resolved {
+		tags[item.Tag] = true
+	}
+	if len(resolved) != 2 || !tags["a"] || !tags["c"] {
+		t.Fatalf("resolved = %+v, want a and c", resolved)
+	}
+	if len(p.firing) != 1 || p.firing["b"] != current {
+		t.Fatalf("firing = %+v, want only the current b", p.firing)
+	}
+	if current.Since == 0 || current.Total != 3 {
+		t.Fatalf("b = %+v, want since inherited and total 3", current)
+	}
+
+	// 没有新恢复的分组时不通知
+	p.resolve([]*consumer.Group{current})
+	if len(recorder.all()) != 1 {
+		t.Fatalf("messages = %+v, want no new message", recorder.all())
+	}
+}
@@ -0,0 +1,401 @@
+package flr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+	"github.com/LukeEuler/funnel-log-reporter/state"
+)
+
+// router 按 routes 将报警分组发送到不同的 channel
+type router struct {
+	conf     *config.Job
+	channels map[string]*consumer.Consumer
+	routes   []*config.Route
+
+	// 静默时段, 下标与 routes 一致, 没有单独配置时使用 quiet
+	schedules []*quietSchedule
+	quiet     *quietSchedule
+	deferred  map[string]*deferred
+	// 只被缓存, 还没有发送到任何 channel 的分组, 汇总发送之前不记录为已报警
+	held map[string]bool
+	// 最近一次发送时, 没有交给任何 target 也没有写入 outbox 的分组, 不记录为已报警
+	undelivered map[string]bool
+
+	// 最近发送的通知, 用于管理接口
+	recent *notifications
+	// 等待发送的通知, 每次发送前保存, key 为 channel
+	outbox state.Store
+}
+
+func newRouter(conf *config.Job) (*router, error) {
+	r := &router{
+		conf:     conf,
+		channels: make(map[string]*consumer.Consumer),
+		routes:   conf.Routes,
+		deferred: make(map[string]*deferred),
+		held:     make(map[string]bool),
+		recent:   new(notifications),
+		outbox:   state.New(conf.GetOutboxPath()),
+
+		undelivered: make(map[string]bool),
+	}
+	for name, targets := range conf.GetChannels() {
+		c, err := newConsumer(conf, targets)
+		if err != nil {
+			return nil, err
+		}
+		c.SetPersist(r.saveOutbox)
+		r.channels[name] = c
+	}
+
+	var err error
+	r.quiet, err = newQuietSchedule(conf.Quiet)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range conf.Routes {
+		schedule, err := newQuietSchedule(route.Quiet)
+		if err != nil {
+			return nil, err
+		}
+		r.schedules = append(r.schedules, schedule)
+	}
+	return r, nil
+}
+
+// restoreOutbox 恢复重启前等待发送的通知, 已经删除的 channel 丢弃
+func (r *router) restoreOutbox() error {
+	outbox := make(map[string][]*consumer.Pending)
+	_, err := r.outbox.Load(&outbox)
+	if err != nil {
+		return err
+	}
+	for name, list := range outbox {
+		if c, ok := r.channels[name]; ok {
+			c.Restore(list)
+		}
+	}
+	return nil
+}
+
+func (r *router) saveOutbox() {
+	outbox := make(map[string][]*consumer.Pending, len(r.channels))
+	for name, c := range r.channels {
+		if list := c.Pending(); len(list) > 0 {
+			outbox[name] = list
+		}
+	}
+	err := r.outbox.Save(outbox)
+	if err != nil {
+		log.Entry.WithError(err).WithField("job", r.conf.Name).Error(err)
+	}
+}
+
+// schedule route 为 -1 时, 表示未匹配任何路由
+func (r *router) schedule(route int) *quietSchedule {
+	if route >= 0 && r.schedules[route] != nil {
+		return r.schedules[route]
+	}
+	return r.quiet
+}
+
+// routed 发送到同一个 channel 的分组
+type routed struct {
+	groups   []*consumer.Group
+	mentions config.Mentions
+	// 分组对应的第一个路由, 决定使用哪个静默时段
+	routes map[string]int
+}
+
+func (r *routed) add(group *consumer.Group, match routeMatch) {
+	if _, ok := r.routes[group.Tag]; !ok {
+		r.routes[group.Tag] = match.index
+		r.groups = append(r.groups, group)
+	}
+	if match.route != nil {
+		r.mentions = mergeMentions(r.mentions, match.route.Mentions)
+	}
+}
+
+// send 启动/心跳等没有分组的消息, 只发送到 default
+// 静默时段内, 非紧急的报警分组会被缓存, 分组在缓存期间恢复时, 不会发送到该 channel
+func (r *router) send(msg *consumer.Message) consumer.Results {
+	groups := msg.Groups
+	if msg.Kind == consumer.KindRecover {
+		groups = msg.Resolved
+	}
+	if len(groups) == 0 {
+		results := withChannel(config.DefaultChannel, r.channels[config.DefaultChannel].SendMessage(msg))
+		r.recent.add(msg, results)
+		return results
+	}
+
+	names := make([]string, 0)
+	result := make(map[string]*routed)
+	for _, group := range groups {
+		for _, match := range r.match(group) {
+			for _, name := range match.channels() {
+				item, ok := result[name]
+				if !ok {
+					item = &routed{routes: make(map[string]int)}
+					result[name] = item
+					names = append(names, name)
+				}
+				item.add(group, match)
+			}
+		}
+	}
+
+	now := time.Now()
+	results := make(consumer.Results, 0)
+	held := make(map[string]bool)
+	sent := make(map[string]bool)
+	delivered := make(map[string]bool)
+	for _, name := range names {
+		item := result[name]
+		temp := *msg
+		if msg.Kind == consumer.KindRecover {
+			temp.Resolved = make([]*consumer.Group, 0, len(item.groups))
+			for _, group := range item.groups {
+				if !r.undefer(name, group.Tag) {
+					temp.Resolved = append(temp.Resolved, group)
+				}
+			}
+			if len(temp.Resolved) == 0 {
+				continue
+			}
+			temp.Content = recoverContent(temp.Resolved, msg.Footer)
+		} else {
+			temp.Groups = r.deferGroups(name, item, now)
+			for _, group := range item.groups {
+				held[group.Tag] = true
+			}
+			for _, group := range temp.Groups {
+				sent[group.Tag] = true
+			}
+			if len(temp.Groups) == 0 {
+				continue
+			}
+			temp.Content = alertContent(temp.Groups, msg.Footer)
+		}
+		addMentions(&temp, item.mentions)
+		channelResults := withChannel(name, r.channels[name].SendMessage(&temp))
+		if channelResults.Handled() {
+			for _, group := range temp.Groups {
+				delivered[group.Tag] = true
+			}
+		}
+		results = append(results, channelResults...)
+	}
+	for tag := range held {
+		if sent[tag] {
+			delete(r.held, tag)
+		} else {
+			r.held[tag] = true
+		}
+	}
+	for tag := range sent {
+		if delivered[tag] {
+			delete(r.undelivered, tag)
+		} else {
+			r.undelivered[tag] = true
+		}
+	}
+	if len(results) > 0 {
+		r.recent.add(msg, results)
+	}
+	return results
+}
+
+func withChannel(name string, results consumer.Results) consumer.Results {
+	for _, item := range results {
+		item.Channel = name
+	}
+	return results
+}
+
+// deferGroups 缓存处于静默时段的分组, 返回需要立即发送的分组
+func (r *router) deferGroups(channel string, item *routed, now time.Time) []*consumer.Group {
+	result := make([]*consumer.Group, 0, len(item.groups))
+	collection := make(map[int][]*consumer.Group)
+	for _, group := range item.groups {
+		route := item.routes[group.Tag]
+		schedule := r.schedule(route)
+		if !schedule.active(now) || schedule.bypass(group) {
+			result = append(result, group)
+			continue
+		}
+		collection[route] = append(collection[route], group)
+	}
+
+	for route, groups := range collection {
+		key := deferredKey(channel, route)
+		d, ok := r.deferred[key]
+		if !ok {
+			d = &deferred{Channel: channel, Route: route, Since: now}
+			r.deferred[key] = d
+		}
+		d.add(groups)
+	}
+	return result
+}
+
+// flush 静默结束后, 汇总发送缓存的报警, 以及被限流的通知数量
+// 同时返回汇总发送的分组, 由调用方记录为已报警
+func (r *router) flush() (consumer.Results, []*consumer.Group) {
+	results := make(consumer.Results, 0)
+	fired := make([]*consumer.Group, 0)
+	for name, c := range r.channels {
+		results = append(results, withChannel(name, c.Flush())...)
+	}
+
+	now := time.Now()
+	keys := make([]string, 0, len(r.deferred))
+	for key := range r.deferred {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		d := r.deferred[key]
+		c, ok := r.channels[d.Channel]
+		if !ok || d.Route >= len(r.routes) {
+			// 配置已修改, 丢弃
+			delete(r.deferred, key)
+			continue
+		}
+		if r.schedule(d.Route).active(now) {
+			continue
+		}
+
+		footer := fmt.Sprintf("静默时段: %s ~ %s",
+			d.Since.Format(time.DateTime), now.Format(time.DateTime))
+		// 发送失败的 target 由 consumer 重试
+		channelResults := withChannel(d.Channel, c.SendMessage(&consumer.Message{
+			Job:     r.conf.Name,
+			Kind:    consumer.KindAlert,
+			Title:   fmt.Sprintf("静默期间的报警汇总: %d 次报警, %d 个分组", d.Alerts, len(d.Groups)),
+			Color:   r.conf.Custom.AlertColor,
+			Content: alertContent(d.Groups, footer),
+			Footer:  footer,
+			Notify:  true,
+			Groups:  d.Groups,
+		}))
+		results = append(results, channelResults...)
+		for _, group := range d.Groups {
+			delete(r.held, group.Tag)
+		}
+		if channelResults.Handled() {
+			for _, group := range d.Groups {
+				delete(r.undelivered, group.Tag)
+			}
+			fired = append(fired, d.Groups...)
+		}
+		delete(r.deferred, key)
+	}
+	return results, fired
+}
+
+type routeMatch struct {
+	index int // -1 表示未匹配任何路由
+	route *config.Route
+}
+
+func (m routeMatch) channels() []string {
+	if m.route == nil {
+		return []string{config.DefaultChannel}
+	}
+	return m.route.Channels
+}
+
+// match 未匹配任何路由时, 使用 default
+func (r *router) match(group *consumer.Group) []routeMatch {
+	result := make([]routeMatch, 0, 1)
+	for idx, route := range r.routes {
+		if !matchRoute(route, group) {
+			continue
+		}
+		result = append(result, routeMatch{idx, route})
+		if !route.Continue {
+			break
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, routeMatch{-1, nil})
+	}
+	return result
+}
+
+func matchRoute(route *config.Route, group *consumer.Group) bool {
+	if len(route.Rules) > 0 && !containsString(route.Rules, group.RuleID) {
+		return false
+	}
+	if len(route.Levels) > 0 {
+		if len(group.RuleID) == 0 {
+			return false
+		}
+		found := false
+		for _, level := range route.Levels {
+			if level == group.Level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for key, value := range route.Match {
+		found := false
+		for idx, name := range group.Keys {
+			if name == key && idx < len(group.Values) && group.Values[idx] == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// addMentions 在消息中追加额外 @ 的人员, 不修改原有的切片
+func addMentions(msg *consumer.Message, m config.Mentions) {
+	msg.Mobiles = appendUnique(append([]string{}, msg.Mobiles...), m.Mobiles...)
+	msg.LarkUserIDs = appendUnique(append([]string{}, msg.LarkUserIDs...), m.LarkUserIDs...)
+	msg.SlackUsers = appendUnique(append([]string{}, msg.SlackUsers...), m.SlackUsers...)
+	msg.SlackGroups = appendUnique(append([]string{}, msg.SlackGroups...), m.SlackGroups...)
+}
+
+func mergeMentions(a, b config.Mentions) config.Mentions {
+	return config.Mentions{
+		Mobiles:     appendUnique(append([]string{}, a.Mobiles...), b.Mobiles...),
+		LarkUserIDs: appendUnique(append([]string{}, a.LarkUserIDs...), b.LarkUserIDs...),
+		SlackUsers:  appendUnique(append([]string{}, a.SlackUsers...), b.SlackUsers...),
+		SlackGroups: appendUnique(append([]string{}, a.SlackGroups...), b.SlackGroups...),
+	}
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !containsString(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
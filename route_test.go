@@ -0,0 +1,96 @@
+package flr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+func TestMatchRoute(t *testing.T) {
+	group := &consumer.Group{
+		Keys:   []string{"chain", "component"},
+		Values: []string{"eth", "node"},
+		RuleID: "0_1",
+		Level:  1,
+	}
+	noRule := &consumer.Group{
+		Keys:   []string{"chain", "component"},
+		Values: []string{"eth", "node"},
+	}
+	tests := []struct {
+		name  string
+		route *config.Route
+		group *consumer.Group
+		match bool
+	}{
+		{"empty", &config.Route{}, group, true},
+		{"rule", &config.Route{Rules: []string{"0_2", "0_1"}}, group, true},
+		{"other rule", &config.Route{Rules: []string{"0_2"}}, group, false},
+		{"level", &config.Route{Levels: []int{0, 1}}, group, true},
+		{"other level", &config.Route{Levels: []int{0}}, group, false},
+		{"level without rule", &config.Route{Levels: []int{0}}, noRule, false},
+		{"match", &config.Route{Match: map[string]string{"chain": "eth", "component": "node"}}, group, true},
+		{"match value", &config.Route{Match: map[string]string{"chain": "btc"}}, group, false},
+		{"match unknown key", &config.Route{Match: map[string]string{"host": "a"}}, group, false},
+		{"all", &config.Route{Rules: []string{"0_1"}, Levels: []int{1}, Match: map[string]string{"chain": "eth"}}, group, true},
+		{"all but one", &config.Route{Rules: []string{"0_1"}, Levels: []int{1}, Match: map[string]string{"chain": "btc"}}, group, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchRoute(tt.route, tt.group); got != tt.match {
+				t.Fatalf("matchRoute() = %v, want %v", got, tt.match)
+			}
+		})
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := &router{routes: []*config.Route{
+		{Match: map[string]string{"chain": "eth"}, Channels: []string{"eth"}, Continue: true},
+		{Levels: []int{1}, Channels: []string{"oncall"}},
+		{Match: map[string]string{"chain": "eth"}, Channels: []string{"never"}},
+	}}
+	tests := []struct {
+		name  string
+		group *consumer.Group
+		want  []int
+	}{
+		{"continue", &consumer.Group{Keys: []string{"chain"}, Values: []string{"eth"}, RuleID: "0_1", Level: 1}, []int{0, 1}},
+		{"first only", &consumer.Group{Keys: []string{"chain"}, Values: []string{"eth"}}, []int{0, 2}},
+		{"default", &consumer.Group{Keys: []string{"chain"}, Values: []string{"btc"}}, []int{-1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.match(tt.group)
+			if len(got) != len(tt.want) {
+				t.Fatalf("match() = %+v, want routes %v", got, tt.want)
+			}
+			for idx, item := range got {
+				if item.index != tt.want[idx] {
+					t.Fatalf("match() = %+v, want routes %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddMentions(t *testing.T) {
+	msg := &consumer.Message{Mobiles: []string{"130"}, SlackUsers: []string{"U1"}}
+	origin := msg.Mobiles
+	m := mergeMentions(
+		config.Mentions{Mobiles: []string{"130", "131"}, LarkUserIDs: []string{"ou_1"}},
+		config.Mentions{SlackUsers: []string{"U1", "U2"}, SlackGroups: []string{"S1"}},
+	)
+	addMentions(msg, m)
+	if !reflect.DeepEqual(msg.Mobiles, []string{"130", "131"}) ||
+		!reflect.DeepEqual(msg.LarkUserIDs, []string{"ou_1"}) ||
+		!reflect.DeepEqual(msg.SlackUsers, []string{"U1", "U2"}) ||
+		!reflect.DeepEqual(msg.SlackGroups, []string{"S1"}) {
+		t.Fatalf("message mentions = %+v", msg)
+	}
+	if len(origin) != 1 {
+		t.Fatalf("original mobiles modified: %v", origin)
+	}
+}
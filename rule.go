@@ -0,0 +1,88 @@
+package flr
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/LukeEuler/funnel/common"
+	"github.com/LukeEuler/funnel/event"
+	"github.com/LukeEuler/funnel/model"
+	"github.com/pkg/errors"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+)
+
+// probeKey 启动检查时构造的日志字段与规则 id
+const probeKey = "flr_probe"
+
+// eventRule 获取 event 命中的规则, 无法获取时返回 nil
+// 规则均由 config.Job.GetRules 生成, 类型为 *common.EventRuleInfo, 启动时由 checkEventRule 检查
+func eventRule(e model.Event) *common.EventRuleInfo {
+	holder, ok := e.(interface{ GetRule() model.EventRule })
+	if !ok {
+		return nil
+	}
+	info, _ := holder.GetRule().(*common.EventRuleInfo)
+	return info
+}
+
+// checkEventRule 使用构造的日志与规则调用 funnel, 命中的 event 无法取得规则时返回错误
+// 否则按规则路由, 等级, 静默时段的 bypass_level, 规则屏蔽等功能都会失效
+// 构造的日志没有命中时无法判断, 只提示
+func checkEventRule(timeKeys []string) error {
+	data := map[string]string{probeKey: probeKey}
+	now := time.Now().Format(time.RFC3339Nano)
+	for _, key := range timeKeys {
+		data[key] = now
+	}
+	bs, _ := json.Marshal(data)
+	probe := &common.EventRuleInfo{RuleInfo: &common.RuleInfo{
+		ID:      probeKey,
+		Name:    probeKey,
+		Content: fmt.Sprintf("%s = '%s'", probeKey, probeKey),
+	}}
+
+	events, err := event.Draw([]model.EventData{common.NewJSONData(bs).SetTimeKeys(timeKeys...)},
+		[]model.EventRule{probe})
+	if err != nil || len(events) == 0 {
+		log.Entry.WithError(err).Warn("can not check whether funnel events expose their rule")
+		return nil
+	}
+	for _, item := range events {
+		if eventRule(item) == probe {
+			return nil
+		}
+	}
+	return errors.Errorf("funnel event %T does not expose its rule as *common.EventRuleInfo", events[0])
+}
+
+// setGroupRule 分组内可能命中多个规则, 使用等级最高(level 最小)的规则
+func setGroupRule(group *consumer.Group, events []model.Event) {
+	var result *common.EventRuleInfo
+	for _, item := range events {
+		info := eventRule(item)
+		if info == nil || info.RuleInfo == nil {
+			continue
+		}
+		if result == nil || info.Level < result.Level {
+			result = info
+		}
+	}
+	if result == nil {
+		return
+	}
+	group.RuleID = result.ID
+	group.RuleName = result.Name
+	group.Level = result.Level
+}
+
+// groupKeyNames 每个分组字段的名称, 取第一个候选字段
+func groupKeyNames(groupKeys [][]string) []string {
+	result := make([]string, 0, len(groupKeys))
+	for _, keys := range groupKeys {
+		result = append(result, keys[0])
+	}
+	return result
+}
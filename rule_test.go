@@ -0,0 +1,47 @@
+package flr
+
+import (
+	"testing"
+
+	"github.com/LukeEuler/funnel/common"
+	"github.com/LukeEuler/funnel/model"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+// TestCheckEventRule 使用实际依赖的 funnel 版本, event 需要能取得命中的规则
+func TestCheckEventRule(t *testing.T) {
+	if err := checkEventRule([]string{"time"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type ruleEvent struct {
+	model.Event
+	rule model.EventRule
+}
+
+func (e *ruleEvent) GetRule() model.EventRule {
+	return e.rule
+}
+
+func TestSetGroupRule(t *testing.T) {
+	newRule := func(id string, level int) *common.EventRuleInfo {
+		return &common.EventRuleInfo{RuleInfo: &common.RuleInfo{ID: id, Name: "rule " + id}, Level: level}
+	}
+	group := new(consumer.Group)
+	setGroupRule(group, []model.Event{
+		&ruleEvent{rule: newRule("0_2", 2)},
+		&ruleEvent{rule: newRule("0_1", 1)},
+		&ruleEvent{rule: newRule("0_3", 3)},
+	})
+	if group.RuleID != "0_1" || group.RuleName != "rule 0_1" || group.Level != 1 {
+		t.Fatalf("group = %+v, want rule 0_1", group)
+	}
+
+	group = new(consumer.Group)
+	setGroupRule(group, []model.Event{new(ruleEvent)})
+	if len(group.RuleID) != 0 {
+		t.Fatalf("group = %+v, want no rule", group)
+	}
+}
@@ -0,0 +1,91 @@
+package flr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/log"
+)
+
+// /readyz 中检查数据源的超时
+const pingTimeout = 3 * time.Second
+
+// Server 可选的 HTTP 服务
+type Server struct {
+	conf       *config.HTTP
+	processors []*Processor
+	mux        *http.ServeMux
+}
+
+func NewServer(conf *config.HTTP, processors []*Processor) *Server {
+	s := &Server{
+		conf:       conf,
+		processors: processors,
+		mux:        http.NewServeMux(),
+	}
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.writeStatus(w, r, false)
+	})
+	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.writeStatus(w, r, true)
+	})
+	if conf.Admin {
+		s.registerAdmin()
+	}
+	return s
+}
+
+func (s *Server) Loop(shutdown chan struct{}) {
+	server := &http.Server{
+		Addr:              s.conf.Listen,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	log.Entry.Infof("http server listen on %s", s.conf.Listen)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Entry.WithError(err).Fatal(err)
+	}
+}
+
+// writeStatus 任意一个 job 不正常时返回 503
+func (s *Server) writeStatus(w http.ResponseWriter, r *http.Request, ready bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+
+	ok := true
+	jobs := make([]*jobStatus, 0, len(s.processors))
+	for _, p := range s.processors {
+		status := p.status(ctx, ready, s.conf.GetStaleCycles())
+		ok = ok && status.OK
+		jobs = append(jobs, status)
+	}
+
+	code := http.StatusOK
+	if !ok {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"ok":   ok,
+		"jobs": jobs,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
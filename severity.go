@@ -0,0 +1,90 @@
+package flr
+
+import (
+	"sort"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+// sendAlert 发送报警消息, 按分组中等级最高(level 最小)的规则设置颜色, 标题前缀与 @ 人员
+// split_by_level 为 true 时, 每个等级单独发送一条消息
+func (p *Processor) sendAlert(title string, groups []*consumer.Group, footer string) error {
+	if !p.conf.SplitByLevel {
+		return p.send(p.newAlertMessage(title, groups, footer))
+	}
+
+	levels := make([]int, 0)
+	collection := make(map[int][]*consumer.Group)
+	noRule := make([]*consumer.Group, 0)
+	for _, item := range groups {
+		if len(item.RuleID) == 0 {
+			noRule = append(noRule, item)
+			continue
+		}
+		if _, ok := collection[item.Level]; !ok {
+			levels = append(levels, item.Level)
+		}
+		collection[item.Level] = append(collection[item.Level], item)
+	}
+	sort.Ints(levels)
+
+	var result error
+	send := func(list []*consumer.Group) {
+		if len(list) == 0 {
+			return
+		}
+		err := p.send(p.newAlertMessage(title, list, footer))
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+	for _, level := range levels {
+		send(collection[level])
+	}
+	send(noRule)
+	return result
+}
+
+func (p *Processor) newAlertMessage(title string, groups []*consumer.Group, footer string) *consumer.Message {
+	msg := &consumer.Message{
+		Kind:    consumer.KindAlert,
+		Title:   title,
+		Color:   p.conf.Custom.AlertColor,
+		Content: alertContent(groups, footer),
+		Footer:  footer,
+		Notify:  true,
+		Groups:  groups,
+	}
+
+	level, ok := highestLevel(groups)
+	if !ok {
+		return msg
+	}
+	item := p.conf.GetLevel(level)
+	if item == nil {
+		return msg
+	}
+	if len(item.Color) > 0 {
+		msg.Color = item.Color
+	}
+	msg.Title = item.TitlePrefix + msg.Title
+	if item.Notify != nil {
+		msg.Notify = *item.Notify
+	}
+	addMentions(msg, item.Mentions)
+	return msg
+}
+
+// highestLevel 没有规则信息的分组不参与比较
+func highestLevel(groups []*consumer.Group) (int, bool) {
+	level, ok := 0, false
+	for _, item := range groups {
+		if len(item.RuleID) == 0 {
+			continue
+		}
+		if !ok || item.Level < level {
+			level, ok = item.Level, true
+		}
+	}
+	return level, ok
+}
@@ -0,0 +1,179 @@
+package flr
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+// Silence 在 Start~End 内, 屏蔽满足条件的分组
+// 条件需要同时满足: Rules 中的任意一个, 以及 Match 中的全部字段
+type Silence struct {
+	ID      string            `json:"id"`
+	Rules   []string          `json:"rules,omitempty"`
+	Match   map[string]string `json:"match,omitempty"` // 日志字段的值, 包括 group_keys, show_keys 及其他字段
+	Start   time.Time         `json:"start"`
+	End     time.Time         `json:"end"`
+	Comment string            `json:"comment,omitempty"`
+}
+
+func (s *Silence) active(now time.Time) bool {
+	return !now.Before(s.Start) && now.Before(s.End)
+}
+
+func (s *Silence) match(group *consumer.Group, getValue func(key string) (string, bool)) bool {
+	if len(s.Rules) > 0 && !containsString(s.Rules, group.RuleID) {
+		return false
+	}
+	for key, value := range s.Match {
+		v, ok := getValue(key)
+		if !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// silencer 会被管理接口并发访问
+type silencer struct {
+	mu   sync.Mutex
+	list []*Silence
+}
+
+func newSilencer(list []*config.Silence) (*silencer, error) {
+	s := new(silencer)
+	for idx, item := range list {
+		silence := &Silence{
+			ID:      item.ID,
+			Rules:   item.Rules,
+			Match:   item.Match,
+			Start:   item.Start,
+			End:     item.End,
+			Comment: item.Comment,
+		}
+		if len(silence.ID) == 0 {
+			return nil, errors.Errorf("id of silences[%d] is empty", idx)
+		}
+		_, err := s.add(silence)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// add ID 为空时自动生成, ID 已存在时覆盖
+func (s *silencer) add(item *Silence) (*Silence, error) {
+	if !item.End.After(item.Start) {
+		return nil, errors.Errorf("silence end %s is not after start %s", item.End, item.Start)
+	}
+	if len(item.Rules) == 0 && len(item.Match) == 0 {
+		return nil, errors.New("silence matches everything, rules or match is required")
+	}
+	if len(item.ID) == 0 {
+		bs := make([]byte, 8)
+		_, err := rand.Read(bs)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		item.ID = hex.EncodeToString(bs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for idx, old := range s.list {
+		if old.ID == item.ID {
+			s.list[idx] = item
+			return item, nil
+		}
+	}
+	s.list = append(s.list, item)
+	return item, nil
+}
+
+func (s *silencer) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for idx, item := range s.list {
+		if item.ID == id {
+			s.list = append(s.list[:idx], s.list[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// all 按开始时间排序, 同时清理已过期的屏蔽
+func (s *silencer) all() []*Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	result := make([]*Silence, 0, len(s.list))
+	for _, item := range s.list {
+		if now.Before(item.End) {
+			result = append(result, item)
+		}
+	}
+	s.list = result
+	result = append([]*Silence{}, result...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// restore 合并状态文件中的屏蔽, 配置文件中的同名屏蔽优先
+func (s *silencer) restore(list []*Silence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exist := make(map[string]bool, len(s.list))
+	for _, item := range s.list {
+		exist[item.ID] = true
+	}
+	for _, item := range list {
+		if !exist[item.ID] {
+			s.list = append(s.list, item)
+		}
+	}
+}
+
+func (s *silencer) silenced(group *consumer.Group, getValue func(key string) (string, bool)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, item := range s.list {
+		if item.active(now) && item.match(group, getValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchKeys 屏蔽条件中的字段, 聚合模式下样例日志需要包含这些字段
+func (s *silencer) matchKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]string, 0)
+	for _, item := range s.list {
+		for key := range item.Match {
+			result = appendUnique(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func silencedFooter(silenced int) string {
+	if silenced == 0 {
+		return ""
+	}
+	return fmt.Sprintf("已屏蔽 %d 个分组", silenced)
+}
@@ -0,0 +1,81 @@
+package flr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LukeEuler/funnel-log-reporter/consumer"
+)
+
+func TestSilenceMatch(t *testing.T) {
+	values := map[string]string{"chain": "eth", "k8s.pod": "node-0"}
+	getValue := func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+	group := &consumer.Group{Tag: "eth", RuleID: "0_1"}
+
+	tests := []struct {
+		name    string
+		silence *Silence
+		want    bool
+	}{
+		{"rule", &Silence{Rules: []string{"0_0", "0_1"}}, true},
+		{"other rule", &Silence{Rules: []string{"0_0"}}, false},
+		{"match", &Silence{Match: map[string]string{"chain": "eth", "k8s.pod": "node-0"}}, true},
+		{"match value differs", &Silence{Match: map[string]string{"chain": "btc"}}, false},
+		{"match field missing", &Silence{Match: map[string]string{"host": "a"}}, false},
+		{"rule and match", &Silence{Rules: []string{"0_1"}, Match: map[string]string{"chain": "eth"}}, true},
+		{"rule but not match", &Silence{Rules: []string{"0_1"}, Match: map[string]string{"chain": "btc"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.silence.match(group, getValue); got != tt.want {
+				t.Fatalf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilencer(t *testing.T) {
+	now := time.Now()
+	s := new(silencer)
+	if _, err := s.add(&Silence{Rules: []string{"0_0"}, Start: now, End: now}); err == nil {
+		t.Fatal("end not after start should be rejected")
+	}
+	if _, err := s.add(&Silence{Start: now, End: now.Add(time.Hour)}); err == nil {
+		t.Fatal("silence without rules or match should be rejected")
+	}
+
+	active, err := s.add(&Silence{Rules: []string{"0_0"}, Start: now.Add(-time.Hour), End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active.ID) == 0 {
+		t.Fatal("id should be generated")
+	}
+	_, err = s.add(&Silence{ID: "later", Rules: []string{"0_1"}, Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 已过期的屏蔽直接加入, 模拟运行期间过期
+	s.list = append(s.list, &Silence{ID: "expired", Rules: []string{"0_2"}, Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+
+	noValue := func(string) (string, bool) { return "", false }
+	for rule, want := range map[string]bool{"0_0": true, "0_1": false, "0_2": false} {
+		if got := s.silenced(&consumer.Group{RuleID: rule}, noValue); got != want {
+			t.Fatalf("silenced(%s) = %v, want %v", rule, got, want)
+		}
+	}
+
+	list := s.all()
+	if len(list) != 2 || list[0].ID != active.ID || list[1].ID != "later" {
+		t.Fatalf("all = %+v, want the active and the later silence", list)
+	}
+	if len(s.list) != 2 {
+		t.Fatalf("expired silence should be removed: %+v", s.list)
+	}
+	if !s.remove("later") || s.remove("later") {
+		t.Fatal("remove should succeed only once")
+	}
+}
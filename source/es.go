@@ -0,0 +1,51 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+	"github.com/LukeEuler/funnel-log-reporter/es"
+)
+
+type esSource struct {
+	client *es.Client
+	conf   *es.Config
+}
+
+func newEs(conf *config.Job) (*esSource, error) {
+	client, err := es.NewClient(conf.Es.Address, conf.Es.Username, conf.Es.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &esSource{
+		client: client,
+		conf:   conf.ToEsConfig(),
+	}, nil
+}
+
+func (s *esSource) GetMessageByRange(gte, lte int64) ([]json.RawMessage, bool, error) {
+	return s.client.GetMessageByRange(gte, lte, s.conf)
+}
+
+func (s *esSource) AggregateByRange(gte, lte int64, groupKeys, sampleKeys []string) ([]*Bucket, bool, error) {
+	buckets, truncated, err := s.client.AggregateByRange(gte, lte, groupKeys, sampleKeys, s.conf)
+	if err != nil {
+		return nil, false, err
+	}
+	result := make([]*Bucket, 0, len(buckets))
+	for _, item := range buckets {
+		result = append(result, &Bucket{
+			Values:   item.Values,
+			Missing:  item.Missing,
+			Count:    item.Count,
+			LastTime: item.LastTime,
+			Sample:   item.Sample,
+		})
+	}
+	return result, truncated, nil
+}
+
+func (s *esSource) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx)
+}
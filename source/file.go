@@ -0,0 +1,95 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+)
+
+// fileSource 读取本地文件, 每行一条 json 日志
+// 每次查询都会完整读取文件, 仅适用于少量数据
+type fileSource struct {
+	pattern       string
+	rangeTimeName string
+}
+
+func newFile(conf *config.Job) (*fileSource, error) {
+	if len(conf.File.Path) == 0 {
+		return nil, errors.New("file.path is empty")
+	}
+	_, err := filepath.Glob(conf.File.Path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &fileSource{
+		pattern:       conf.File.Path,
+		rangeTimeName: conf.File.RangeTimeName,
+	}, nil
+}
+
+func (s *fileSource) GetMessageByRange(gte, lte int64) ([]json.RawMessage, bool, error) {
+	paths, err := filepath.Glob(s.pattern)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	type record struct {
+		t       int64
+		message json.RawMessage
+	}
+	list := make([]record, 0)
+	for _, path := range paths {
+		err = s.scan(path, func(t int64, message json.RawMessage) {
+			if t >= gte && t <= lte {
+				list = append(list, record{t, message})
+			}
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].t < list[j].t
+	})
+	result := make([]json.RawMessage, 0, len(list))
+	for _, item := range list {
+		result = append(result, item.message)
+	}
+	return result, false, nil
+}
+
+func (s *fileSource) scan(path string, fn func(t int64, message json.RawMessage)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || !gjson.ValidBytes(line) {
+			continue
+		}
+		value := gjson.GetBytes(line, s.rangeTimeName)
+		t, err := time.Parse(time.RFC3339Nano, value.String())
+		if err != nil {
+			continue
+		}
+		message := make(json.RawMessage, len(line))
+		copy(message, line)
+		fn(t.UnixMilli(), message)
+	}
+	return errors.Wrapf(scanner.Err(), "read %s", path)
+}
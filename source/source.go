@@ -0,0 +1,53 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/LukeEuler/funnel-log-reporter/config"
+)
+
+const (
+	TypeEs   = "es"
+	TypeFile = "file"
+)
+
+// Source 日志来源
+type Source interface {
+	// GetMessageByRange 获取 gte~lte(毫秒) 内的 json 日志, 按时间升序
+	// 数据量超过上限时只返回较早的部分, truncated = true
+	GetMessageByRange(gte, lte int64) (result []json.RawMessage, truncated bool, err error)
+}
+
+// Aggregator 由数据源完成分组统计, 只传输每个分组的一条样例日志, 用于大数据量场景
+type Aggregator interface {
+	// AggregateByRange 样例日志只包含 sampleKeys 中的字段
+	// 分组数量超过上限时只返回部分分组, truncated = true
+	AggregateByRange(gte, lte int64, groupKeys, sampleKeys []string) (result []*Bucket, truncated bool, err error)
+}
+
+// Bucket 一个分组的统计结果
+type Bucket struct {
+	Values   []string // 与 groupKeys 一一对应, 缺失时为空
+	Missing  []bool
+	Count    int
+	LastTime int64 // 毫秒
+	Sample   json.RawMessage
+}
+
+// Pinger 检查数据源是否可以访问, 用于 /readyz
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+func New(conf *config.Job) (Source, error) {
+	switch conf.GetSourceType() {
+	case TypeEs:
+		return newEs(conf)
+	case TypeFile:
+		return newFile(conf)
+	}
+	return nil, errors.Errorf("unknown source type %s", conf.Source)
+}
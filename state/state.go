@@ -0,0 +1,85 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Store 持久化运行状态, 防止重启后重复报警
+type Store interface {
+	// Load 读取状态到 v, 状态不存在时返回 false
+	Load(v interface{}) (bool, error)
+	Save(v interface{}) error
+}
+
+// New path 为空时, 状态只保存在内存中
+func New(path string) Store {
+	if len(path) == 0 {
+		return nopStore{}
+	}
+	return &fileStore{path: path}
+}
+
+type nopStore struct{}
+
+func (nopStore) Load(interface{}) (bool, error) { return false, nil }
+
+func (nopStore) Save(interface{}) error { return nil }
+
+// fileStore 以 json 格式保存在本地文件
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Load(v interface{}) (bool, error) {
+	bs, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	err = json.Unmarshal(bs, v)
+	if err != nil {
+		return false, errors.Wrapf(err, "can not parse state file %s", s.path)
+	}
+	return true, nil
+}
+
+// Save 先写临时文件再 rename, 避免进程中途退出导致文件损坏
+func (s *fileStore) Save(v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dir := filepath.Dir(s.path)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(bs)
+	if err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), s.path))
+}
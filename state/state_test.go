@@ -0,0 +1,66 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testState struct {
+	LastLogs int               `json:"last_logs"`
+	Firing   map[string]string `json:"firing"`
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s := New(filepath.Join(dir, "data", "state.json"))
+
+	loaded := new(testState)
+	ok, err := s.Load(loaded)
+	if err != nil || ok {
+		t.Fatalf("Load() = %v, %v, want false for a missing file", ok, err)
+	}
+
+	want := &testState{LastLogs: 3, Firing: map[string]string{"a": "b"}}
+	if err = s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = s.Load(loaded)
+	if err != nil || !ok {
+		t.Fatalf("Load() = %v, %v", ok, err)
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("Load() = %+v, want %+v", loaded, want)
+	}
+
+	// 临时文件已经 rename 或删除
+	entries, err := os.ReadDir(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Fatalf("files = %v, want only state.json", entries)
+	}
+}
+
+func TestFileStoreCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(path).Load(new(testState)); err == nil {
+		t.Fatal("Load() should fail for a corrupted file")
+	}
+}
+
+func TestNopStore(t *testing.T) {
+	s := New("")
+	if err := s.Save(&testState{LastLogs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := s.Load(new(testState))
+	if err != nil || ok {
+		t.Fatalf("Load() = %v, %v, want nothing saved", ok, err)
+	}
+}